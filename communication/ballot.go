@@ -0,0 +1,49 @@
+package communication
+
+import "fmt"
+
+// Ballot identifies a single proposal attempt. Ballots are totally ordered by Round first and HostID second. Host
+// IDs are unique, so two hosts never issue the same ballot, even when they run proposers of the same instance.
+type Ballot struct {
+	Round  int64 // Monotonically increasing round chosen by the proposer
+	HostID int64 // Host ID of the node whose proposer issued the ballot, used to break ties between rounds
+}
+
+// Compare returns -1, 0 or 1 depending on whether b is lower than, equal to or higher than other.
+func (b Ballot) Compare(other Ballot) int {
+	switch {
+	case b.Round < other.Round:
+		return -1
+	case b.Round > other.Round:
+		return 1
+	case b.HostID < other.HostID:
+		return -1
+	case b.HostID > other.HostID:
+		return 1
+	}
+	return 0
+}
+
+// GreaterThan reports whether b is strictly higher than other.
+func (b Ballot) GreaterThan(other Ballot) bool {
+	return b.Compare(other) > 0
+}
+
+// AtLeast reports whether b is higher than or equal to other.
+func (b Ballot) AtLeast(other Ballot) bool {
+	return b.Compare(other) >= 0
+}
+
+// IsZero reports whether b is the zero ballot, which is lower than any ballot a proposer issues.
+func (b Ballot) IsZero() bool {
+	return b.Round == 0 && b.HostID == 0
+}
+
+// Next returns a ballot owned by proposerID in the round following b, which is always higher than b.
+func (b Ballot) Next(proposerID int64) Ballot {
+	return Ballot{Round: b.Round + 1, HostID: proposerID}
+}
+
+func (b Ballot) String() string {
+	return fmt.Sprintf("%d.%d", b.Round, b.HostID)
+}
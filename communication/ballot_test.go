@@ -0,0 +1,57 @@
+package communication
+
+import "testing"
+
+func TestBallotOrdering(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Ballot
+		want int
+	}{
+		{name: "equal", a: Ballot{Round: 2, HostID: 1}, b: Ballot{Round: 2, HostID: 1}, want: 0},
+		{name: "lower round", a: Ballot{Round: 1, HostID: 9}, b: Ballot{Round: 2, HostID: 1}, want: -1},
+		{name: "higher round", a: Ballot{Round: 3, HostID: 1}, b: Ballot{Round: 2, HostID: 9}, want: 1},
+		{name: "same round lower host", a: Ballot{Round: 2, HostID: 1}, b: Ballot{Round: 2, HostID: 3}, want: -1},
+		{name: "same round higher host", a: Ballot{Round: 2, HostID: 3}, b: Ballot{Round: 2, HostID: 1}, want: 1},
+		{name: "zero below any issued", a: Ballot{}, b: Ballot{Round: 1, HostID: 1}, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Compare(tt.b); got != tt.want {
+				t.Errorf("%v.Compare(%v) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := tt.b.Compare(tt.a); got != -tt.want {
+				t.Errorf("%v.Compare(%v) = %d, want %d", tt.b, tt.a, got, -tt.want)
+			}
+			if got := tt.a.GreaterThan(tt.b); got != (tt.want > 0) {
+				t.Errorf("%v.GreaterThan(%v) = %v", tt.a, tt.b, got)
+			}
+			if got := tt.a.AtLeast(tt.b); got != (tt.want >= 0) {
+				t.Errorf("%v.AtLeast(%v) = %v", tt.a, tt.b, got)
+			}
+		})
+	}
+}
+
+func TestBallotNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		ballot Ballot
+		hostID int64
+		want   Ballot
+	}{
+		{name: "from zero", ballot: Ballot{}, hostID: 2, want: Ballot{Round: 1, HostID: 2}},
+		{name: "over a higher host", ballot: Ballot{Round: 4, HostID: 9}, hostID: 1, want: Ballot{Round: 5, HostID: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.ballot.Next(tt.hostID)
+			if got != tt.want {
+				t.Errorf("%v.Next(%d) = %v, want %v", tt.ballot, tt.hostID, got, tt.want)
+			}
+			if !got.GreaterThan(tt.ballot) {
+				t.Errorf("%v.Next(%d) = %v is not higher", tt.ballot, tt.hostID, got)
+			}
+		})
+	}
+}
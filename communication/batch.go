@@ -0,0 +1,35 @@
+package communication
+
+import "bytes"
+
+// Batch is a value made of several client commands that a leader proposes together in a single slot.
+type Batch []interface{}
+
+// Commands returns the client commands a value carries: the commands of a batch, none for a no-op, or the value
+// itself.
+func Commands(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case Batch:
+		return v
+	case Noop:
+		return nil
+	}
+	return []interface{}{value}
+}
+
+// ValueKey returns a comparable key for a value, so that values can be counted in maps. Batches are not
+// comparable and are keyed by their encoding; every other value is its own key.
+func ValueKey(value interface{}) interface{} {
+	batch, ok := value.(Batch)
+	if !ok {
+		return value
+	}
+	buf := new(bytes.Buffer)
+	if err := writeValue(buf, batch); err != nil {
+		return err.Error()
+	}
+	return batchKey(buf.String())
+}
+
+// batchKey is the map key of a batch, kept apart from string values with the same content.
+type batchKey string
@@ -0,0 +1,41 @@
+package communication
+
+import "fmt"
+
+// Command is a client command as it travels through the log, tagged with the proposer that took it from the client
+// and a sequence number that proposer gave it. Two submissions of the same value are different commands, so a
+// proposer can tell its own commands apart from equal ones that others proposed.
+type Command struct {
+	Origin int64       // Host ID of the proposer that took the command from the client
+	Seq    int64       // Sequence number the origin gave the command, unique among its commands
+	Value  interface{} // The value the client submitted
+}
+
+// Noop is the value a new leader proposes in a slot below a recovered one that Phase 1 found empty, so that the
+// slots above it can be reported. It carries no client command.
+type Noop struct{}
+
+// String returns the client's value, so that events show what was submitted.
+func (c Command) String() string {
+	return fmt.Sprint(c.Value)
+}
+
+// SameCommand reports whether a and b are the same command, judged by origin and sequence number only. Values
+// that are not commands are never the same as anything.
+func SameCommand(a interface{}, b interface{}) bool {
+	ca, ok := a.(Command)
+	if !ok {
+		return false
+	}
+	cb, ok := b.(Command)
+	return ok && ca.Origin == cb.Origin && ca.Seq == cb.Seq
+}
+
+// CommandValue returns the value a client submitted in a command. Values that are not commands are returned
+// unchanged.
+func CommandValue(command interface{}) interface{} {
+	if c, ok := command.(Command); ok {
+		return c.Value
+	}
+	return command
+}
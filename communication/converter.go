@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"net"
+	"io"
 	"reflect"
 )
 
@@ -14,22 +14,84 @@ const (
 	PROMISE  = 2
 	ACCEPT   = 3
 	ACCEPTED = 4
+	// Rejections carrying the acceptor's promised ballot
+	PREPARE_NACK = 5
+	ACCEPT_NACK  = 6
+	// Leader election
+	HEARTBEAT = 7
+	FORWARD   = 8
+	// Egalitarian Paxos
+	PRE_ACCEPT       = 9
+	PRE_ACCEPT_OK    = 10
+	EPAXOS_ACCEPT    = 11
+	EPAXOS_ACCEPT_OK = 12
+	COMMIT           = 13
+	// Cheap Paxos
+	RELEASE = 14
+	// Reconfiguration
+	CONFIGURE = 15
+	// Leader leases
+	LEASE       = 16
+	LEASE_GRANT = 17
+	// Leadership confirmation for ReadIndex reads
+	CONFIRM    = 18
+	CONFIRM_OK = 19
+	// Log compaction
+	COMPACT = 20
+	// Catch-up of lagging learners
+	CATCHUP       = 21
+	CATCHUP_REPLY = 22
+	SNAPSHOT      = 23
 	// DataTypes
 	NIL     = 0
 	INT64   = 1
 	FLOAT64 = 2
 	STRING  = 3
+	BATCH   = 4
+	COMMAND = 5
+	NOOP    = 6
 )
 
+// HeaderSize is the encoded size of a MessageHeader.
+const HeaderSize = 32
+
+// MaxPayloadSize bounds the payload of a message. Lengths are read from the network and from logs on disk, so a
+// corrupt one must not make the reader allocate without limit.
+const MaxPayloadSize = 64 << 20
+
 type MessageHeader struct {
 	SenderID    int64
+	ProposerID  int64 // Proposer a request comes from or a reply is addressed to, so co-located proposers get their own replies
 	MessageType int64
 	PayloadSize int64
 }
 
 type PaxosMessage struct {
-	Proposal int64
-	Value    interface{}
+	Slot      int64         // Index of the log entry (Paxos instance) the message is about, or the first slot a Prepare covers
+	Ballot    Ballot        // Ballot of the request, or the acceptor's promised ballot in a reply
+	Value     interface{}   // Proposed or accepted value
+	Entries   []LogEntry    // Accepted entries at or above Slot, carried by Promise replies
+	Seq       int64         // Sequence number of an EPaxos command
+	Deps      []InstanceRef // EPaxos instances the command depends on
+	Request   int64         // Number of a lease request or a confirmation round, echoed in the reply
+	Compacted int64         // Slot below which the acceptor discarded its state, carried by Promise and CatchUp replies
+	UpTo      int64         // End of the range of slots a CatchUp asks for, exclusive
+	Highest   int64         // The highest slot the acceptor accepted a value in, carried by CatchUp replies
+	Fast      bool          // Set on the Accept that opens a fast round, and on Accepted replies for client values accepted in one
+}
+
+// InstanceRef names an EPaxos instance: the replica owning the instance space and the instance number in it.
+type InstanceRef struct {
+	Replica  int64
+	Instance int64
+}
+
+// LogEntry is a value accepted under a ballot in one slot of the replicated log.
+type LogEntry struct {
+	Slot   int64
+	Ballot Ballot
+	Value  interface{}
+	Fast   bool // Whether the value was accepted from a client in a fast round, which takes a fast quorum to choose it
 }
 
 type Message struct {
@@ -41,59 +103,91 @@ type Message struct {
 func ConvertToBinary(message Message) ([]byte, error) {
 	payloadBuf := new(bytes.Buffer)
 
-	// Write the Proposal to the payload buffer
-	if err := binary.Write(payloadBuf, binary.BigEndian, message.Payload.Proposal); err != nil {
-		return nil, fmt.Errorf("failed to write Proposal: %v", err)
+	// Write the Slot and Ballot to the payload buffer
+	if err := binary.Write(payloadBuf, binary.BigEndian, message.Payload.Slot); err != nil {
+		return nil, fmt.Errorf("failed to write Slot: %v", err)
+	}
+	if err := writeBallot(payloadBuf, message.Payload.Ballot); err != nil {
+		return nil, err
 	}
 
-	// Check if Value is nil
-	if message.Payload.Value == nil {
-		// Write the type indicator for nil
-		if err := binary.Write(payloadBuf, binary.BigEndian, int64(NIL)); err != nil {
-			return nil, fmt.Errorf("failed to write value type indicator: %v", err)
-		}
-		// No need to write any value data for nil
-	} else {
-		// Serialize the Value field with a type indicator
-		switch v := message.Payload.Value.(type) {
-		case int64:
-			if err := binary.Write(payloadBuf, binary.BigEndian, int64(INT64)); err != nil {
-				return nil, fmt.Errorf("failed to write value type indicator: %v", err)
-			}
-			if err := binary.Write(payloadBuf, binary.BigEndian, v); err != nil {
-				return nil, fmt.Errorf("failed to write int64 Value: %v", err)
-			}
-		case float64:
-			if err := binary.Write(payloadBuf, binary.BigEndian, int64(FLOAT64)); err != nil {
-				return nil, fmt.Errorf("failed to write value type indicator: %v", err)
-			}
-			if err := binary.Write(payloadBuf, binary.BigEndian, v); err != nil {
-				return nil, fmt.Errorf("failed to write float64 Value: %v", err)
-			}
-		case string:
-			strBytes := []byte(v)
-			if err := binary.Write(payloadBuf, binary.BigEndian, int64(STRING)); err != nil {
-				return nil, fmt.Errorf("failed to write value type indicator: %v", err)
-			}
-			if err := binary.Write(payloadBuf, binary.BigEndian, int64(len(strBytes))); err != nil {
-				return nil, fmt.Errorf("failed to write string length: %v", err)
-			}
-			if _, err := payloadBuf.Write(strBytes); err != nil {
-				return nil, fmt.Errorf("failed to write string Value: %v", err)
-			}
-		default:
-			return nil, fmt.Errorf("unsupported Value type: %v", reflect.TypeOf(v))
+	// Serialize the Value field with a type indicator
+	if err := writeValue(payloadBuf, message.Payload.Value); err != nil {
+		return nil, err
+	}
+
+	// Serialize the accepted entries
+	if err := binary.Write(payloadBuf, binary.BigEndian, int64(len(message.Payload.Entries))); err != nil {
+		return nil, fmt.Errorf("failed to write entry count: %v", err)
+	}
+	for _, entry := range message.Payload.Entries {
+		if err := binary.Write(payloadBuf, binary.BigEndian, entry.Slot); err != nil {
+			return nil, fmt.Errorf("failed to write entry slot: %v", err)
+		}
+		if err := writeBallot(payloadBuf, entry.Ballot); err != nil {
+			return nil, err
 		}
+		if err := writeValue(payloadBuf, entry.Value); err != nil {
+			return nil, err
+		}
+		if err := writeBool(payloadBuf, entry.Fast); err != nil {
+			return nil, fmt.Errorf("failed to write entry Fast: %v", err)
+		}
+	}
+
+	// Serialize the EPaxos attributes
+	if err := binary.Write(payloadBuf, binary.BigEndian, message.Payload.Seq); err != nil {
+		return nil, fmt.Errorf("failed to write Seq: %v", err)
+	}
+	if err := binary.Write(payloadBuf, binary.BigEndian, int64(len(message.Payload.Deps))); err != nil {
+		return nil, fmt.Errorf("failed to write dependency count: %v", err)
+	}
+	for _, dep := range message.Payload.Deps {
+		if err := binary.Write(payloadBuf, binary.BigEndian, dep.Replica); err != nil {
+			return nil, fmt.Errorf("failed to write dependency replica: %v", err)
+		}
+		if err := binary.Write(payloadBuf, binary.BigEndian, dep.Instance); err != nil {
+			return nil, fmt.Errorf("failed to write dependency instance: %v", err)
+		}
+	}
+
+	// Serialize the lease and confirmation attributes
+	if err := binary.Write(payloadBuf, binary.BigEndian, message.Payload.Request); err != nil {
+		return nil, fmt.Errorf("failed to write Request: %v", err)
+	}
+
+	// Serialize the compaction point
+	if err := binary.Write(payloadBuf, binary.BigEndian, message.Payload.Compacted); err != nil {
+		return nil, fmt.Errorf("failed to write Compacted: %v", err)
+	}
+
+	// Serialize the catch-up attributes
+	if err := binary.Write(payloadBuf, binary.BigEndian, message.Payload.UpTo); err != nil {
+		return nil, fmt.Errorf("failed to write UpTo: %v", err)
+	}
+	if err := binary.Write(payloadBuf, binary.BigEndian, message.Payload.Highest); err != nil {
+		return nil, fmt.Errorf("failed to write Highest: %v", err)
+	}
+
+	// Serialize the fast round marker
+	if err := writeBool(payloadBuf, message.Payload.Fast); err != nil {
+		return nil, fmt.Errorf("failed to write Fast: %v", err)
 	}
 
 	// Compute PayloadSize
 	message.Header.PayloadSize = int64(payloadBuf.Len())
+	if message.Header.PayloadSize > MaxPayloadSize {
+		return nil, fmt.Errorf("payload of %v bytes exceeds the limit of %v", message.Header.PayloadSize, MaxPayloadSize)
+	}
 
 	// Write the Header to the buffer
 	headerBuf := new(bytes.Buffer)
 	if err := binary.Write(headerBuf, binary.BigEndian, message.Header.SenderID); err != nil {
 		return nil, fmt.Errorf("failed to write SenderID: %v", err)
 	}
+	if err := binary.Write(headerBuf, binary.BigEndian, message.Header.ProposerID); err != nil {
+		return nil, fmt.Errorf("failed to write ProposerID: %v", err)
+	}
 	if err := binary.Write(headerBuf, binary.BigEndian, message.Header.MessageType); err != nil {
 		return nil, fmt.Errorf("failed to write MessageType: %v", err)
 	}
@@ -109,7 +203,202 @@ func ConvertToBinary(message Message) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func readFully(conn net.Conn, buffer []byte) error {
+// writeValue writes a value preceded by its type indicator.
+func writeValue(buf *bytes.Buffer, value interface{}) error {
+	// Check if Value is nil
+	if value == nil {
+		// Write the type indicator for nil, no need to write any value data
+		if err := binary.Write(buf, binary.BigEndian, int64(NIL)); err != nil {
+			return fmt.Errorf("failed to write value type indicator: %v", err)
+		}
+		return nil
+	}
+
+	switch v := value.(type) {
+	case int64:
+		if err := binary.Write(buf, binary.BigEndian, int64(INT64)); err != nil {
+			return fmt.Errorf("failed to write value type indicator: %v", err)
+		}
+		if err := binary.Write(buf, binary.BigEndian, v); err != nil {
+			return fmt.Errorf("failed to write int64 Value: %v", err)
+		}
+	case float64:
+		if err := binary.Write(buf, binary.BigEndian, int64(FLOAT64)); err != nil {
+			return fmt.Errorf("failed to write value type indicator: %v", err)
+		}
+		if err := binary.Write(buf, binary.BigEndian, v); err != nil {
+			return fmt.Errorf("failed to write float64 Value: %v", err)
+		}
+	case string:
+		strBytes := []byte(v)
+		if err := binary.Write(buf, binary.BigEndian, int64(STRING)); err != nil {
+			return fmt.Errorf("failed to write value type indicator: %v", err)
+		}
+		if err := binary.Write(buf, binary.BigEndian, int64(len(strBytes))); err != nil {
+			return fmt.Errorf("failed to write string length: %v", err)
+		}
+		if _, err := buf.Write(strBytes); err != nil {
+			return fmt.Errorf("failed to write string Value: %v", err)
+		}
+	case Batch:
+		if err := binary.Write(buf, binary.BigEndian, int64(BATCH)); err != nil {
+			return fmt.Errorf("failed to write value type indicator: %v", err)
+		}
+		if err := binary.Write(buf, binary.BigEndian, int64(len(v))); err != nil {
+			return fmt.Errorf("failed to write batch length: %v", err)
+		}
+		for _, command := range v {
+			if _, nested := command.(Batch); nested {
+				return fmt.Errorf("failed to write batch: batches cannot be nested")
+			}
+			if err := writeValue(buf, command); err != nil {
+				return err
+			}
+		}
+	case Noop:
+		if err := binary.Write(buf, binary.BigEndian, int64(NOOP)); err != nil {
+			return fmt.Errorf("failed to write value type indicator: %v", err)
+		}
+	case Command:
+		switch v.Value.(type) {
+		case Batch, Command, Noop:
+			return fmt.Errorf("failed to write command: its value must be a plain value")
+		}
+		if err := binary.Write(buf, binary.BigEndian, int64(COMMAND)); err != nil {
+			return fmt.Errorf("failed to write value type indicator: %v", err)
+		}
+		if err := binary.Write(buf, binary.BigEndian, v.Origin); err != nil {
+			return fmt.Errorf("failed to write command origin: %v", err)
+		}
+		if err := binary.Write(buf, binary.BigEndian, v.Seq); err != nil {
+			return fmt.Errorf("failed to write command sequence number: %v", err)
+		}
+		if err := writeValue(buf, v.Value); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported Value type: %v", reflect.TypeOf(v))
+	}
+	return nil
+}
+
+// readValue reads a value written by writeValue.
+func readValue(buf *bytes.Reader) (interface{}, error) {
+	// Read the type indicator
+	var valueType int64
+	if err := binary.Read(buf, binary.BigEndian, &valueType); err != nil {
+		return nil, fmt.Errorf("failed to read value type: %v", err)
+	}
+
+	switch valueType {
+	case NIL:
+		return nil, nil
+	case INT64:
+		var int64Value int64
+		if err := binary.Read(buf, binary.BigEndian, &int64Value); err != nil {
+			return nil, fmt.Errorf("failed to read int64 Value: %v", err)
+		}
+		return int64Value, nil
+	case FLOAT64:
+		var floatValue float64
+		if err := binary.Read(buf, binary.BigEndian, &floatValue); err != nil {
+			return nil, fmt.Errorf("failed to read float64 Value: %v", err)
+		}
+		return floatValue, nil
+	case STRING:
+		var strLen int64
+		if err := binary.Read(buf, binary.BigEndian, &strLen); err != nil {
+			return nil, fmt.Errorf("failed to read string length: %v", err)
+		}
+		// The string cannot be longer than what is left of the message
+		if strLen < 0 || strLen > int64(buf.Len()) {
+			return nil, fmt.Errorf("invalid string length %v, %v bytes left", strLen, buf.Len())
+		}
+		strBytes := make([]byte, strLen)
+		if _, err := io.ReadFull(buf, strBytes); err != nil {
+			return nil, fmt.Errorf("failed to read string Value: %v", err)
+		}
+		return string(strBytes), nil
+	case BATCH:
+		var batchLen int64
+		if err := binary.Read(buf, binary.BigEndian, &batchLen); err != nil {
+			return nil, fmt.Errorf("failed to read batch length: %v", err)
+		}
+		// Every command takes at least its type indicator
+		if batchLen < 0 || batchLen > int64(buf.Len()/8) {
+			return nil, fmt.Errorf("invalid batch length %v, %v bytes left", batchLen, buf.Len())
+		}
+		batch := Batch{}
+		for i := int64(0); i < batchLen; i++ {
+			command, err := readValue(buf)
+			if err != nil {
+				return nil, err
+			}
+			batch = append(batch, command)
+		}
+		return batch, nil
+	case COMMAND:
+		var command Command
+		if err := binary.Read(buf, binary.BigEndian, &command.Origin); err != nil {
+			return nil, fmt.Errorf("failed to read command origin: %v", err)
+		}
+		if err := binary.Read(buf, binary.BigEndian, &command.Seq); err != nil {
+			return nil, fmt.Errorf("failed to read command sequence number: %v", err)
+		}
+		value, err := readValue(buf)
+		if err != nil {
+			return nil, err
+		}
+		command.Value = value
+		return command, nil
+	case NOOP:
+		return Noop{}, nil
+	}
+	return nil, fmt.Errorf("unsupported Value type identifier: %v", valueType)
+}
+
+// writeBallot writes the round and host ID of a ballot to the buffer.
+func writeBallot(buf *bytes.Buffer, ballot Ballot) error {
+	if err := binary.Write(buf, binary.BigEndian, ballot.Round); err != nil {
+		return fmt.Errorf("failed to write ballot round: %v", err)
+	}
+	if err := binary.Write(buf, binary.BigEndian, ballot.HostID); err != nil {
+		return fmt.Errorf("failed to write ballot host ID: %v", err)
+	}
+	return nil
+}
+
+// readBallot reads a ballot written by writeBallot.
+func readBallot(buf *bytes.Reader) (Ballot, error) {
+	var ballot Ballot
+	if err := binary.Read(buf, binary.BigEndian, &ballot.Round); err != nil {
+		return Ballot{}, fmt.Errorf("failed to read ballot round: %v", err)
+	}
+	if err := binary.Read(buf, binary.BigEndian, &ballot.HostID); err != nil {
+		return Ballot{}, fmt.Errorf("failed to read ballot host ID: %v", err)
+	}
+	return ballot, nil
+}
+
+// writeBool writes a flag as an int64, 1 for true and 0 for false.
+func writeBool(buf *bytes.Buffer, flag bool) error {
+	var encoded int64
+	if flag {
+		encoded = 1
+	}
+	return binary.Write(buf, binary.BigEndian, encoded)
+}
+
+// readBool reads a flag written by writeBool.
+func readBool(buf *bytes.Reader) (bool, error) {
+	var encoded int64
+	if err := binary.Read(buf, binary.BigEndian, &encoded); err != nil {
+		return false, err
+	}
+	return encoded != 0, nil
+}
+
+func readFully(conn io.Reader, buffer []byte) error {
 	totalRead := 0
 	for totalRead < len(buffer) {
 		n, err := conn.Read(buffer[totalRead:])
@@ -121,9 +410,10 @@ func readFully(conn net.Conn, buffer []byte) error {
 	return nil
 }
 
-func readAndParseMessage(conn net.Conn) (Message, error) {
-	// Step 1: Read the header (12 bytes)
-	header := make([]byte, 24)
+// ReadMessage reads one framed message from a connection or any other stream written with ConvertToBinary.
+func ReadMessage(conn io.Reader) (Message, error) {
+	// Step 1: Read the header
+	header := make([]byte, HeaderSize)
 	if err := readFully(conn, header); err != nil {
 		return Message{}, fmt.Errorf("failed to read header: %v", err)
 	}
@@ -134,6 +424,9 @@ func readAndParseMessage(conn net.Conn) (Message, error) {
 	if err := binary.Read(headerBuf, binary.BigEndian, &msgHeader.SenderID); err != nil {
 		return Message{}, fmt.Errorf("failed to read SenderID: %v", err)
 	}
+	if err := binary.Read(headerBuf, binary.BigEndian, &msgHeader.ProposerID); err != nil {
+		return Message{}, fmt.Errorf("failed to read ProposerID: %v", err)
+	}
 	if err := binary.Read(headerBuf, binary.BigEndian, &msgHeader.MessageType); err != nil {
 		return Message{}, fmt.Errorf("failed to read MessageType: %v", err)
 	}
@@ -142,6 +435,9 @@ func readAndParseMessage(conn net.Conn) (Message, error) {
 	}
 
 	// Step 3: Read the payload
+	if msgHeader.PayloadSize < 0 || msgHeader.PayloadSize > MaxPayloadSize {
+		return Message{}, fmt.Errorf("invalid PayloadSize %v, expected 0 to %v bytes", msgHeader.PayloadSize, MaxPayloadSize)
+	}
 	payload := make([]byte, msgHeader.PayloadSize)
 	if msgHeader.PayloadSize > 0 {
 		if err := readFully(conn, payload); err != nil {
@@ -168,6 +464,9 @@ func ConvertFromBinary(data []byte) (Message, error) {
 	if err := binary.Read(buf, binary.BigEndian, &header.SenderID); err != nil {
 		return Message{}, fmt.Errorf("failed to read SenderID: %v", err)
 	}
+	if err := binary.Read(buf, binary.BigEndian, &header.ProposerID); err != nil {
+		return Message{}, fmt.Errorf("failed to read ProposerID: %v", err)
+	}
 	if err := binary.Read(buf, binary.BigEndian, &header.MessageType); err != nil {
 		return Message{}, fmt.Errorf("failed to read MessageType: %v", err)
 	}
@@ -178,44 +477,84 @@ func ConvertFromBinary(data []byte) (Message, error) {
 	// Read the Payload from the buffer
 	var payload PaxosMessage
 	if header.PayloadSize > 0 {
-		if err := binary.Read(buf, binary.BigEndian, &payload.Proposal); err != nil {
-			return Message{}, fmt.Errorf("failed to read Proposal: %v", err)
+		if err := binary.Read(buf, binary.BigEndian, &payload.Slot); err != nil {
+			return Message{}, fmt.Errorf("failed to read Slot: %v", err)
 		}
+		ballot, err := readBallot(buf)
+		if err != nil {
+			return Message{}, err
+		}
+		payload.Ballot = ballot
 
-		// Read the type indicator
-		var valueType int64
-		if err := binary.Read(buf, binary.BigEndian, &valueType); err != nil {
-			return Message{}, fmt.Errorf("failed to read value type: %v", err)
+		// Read the Value with its type indicator
+		value, err := readValue(buf)
+		if err != nil {
+			return Message{}, err
 		}
+		payload.Value = value
 
-		switch valueType {
-		case NIL:
-			// Set Value to nil
-			payload.Value = nil
-		case INT64:
-			var int64Value int64
-			if err := binary.Read(buf, binary.BigEndian, &int64Value); err != nil {
-				return Message{}, fmt.Errorf("failed to read int64 Value: %v", err)
+		// Read the accepted entries
+		var entryCount int64
+		if err := binary.Read(buf, binary.BigEndian, &entryCount); err != nil {
+			return Message{}, fmt.Errorf("failed to read entry count: %v", err)
+		}
+		for i := int64(0); i < entryCount; i++ {
+			var entry LogEntry
+			if err := binary.Read(buf, binary.BigEndian, &entry.Slot); err != nil {
+				return Message{}, fmt.Errorf("failed to read entry slot: %v", err)
 			}
-			payload.Value = int64Value
-		case FLOAT64:
-			var floatValue float64
-			if err := binary.Read(buf, binary.BigEndian, &floatValue); err != nil {
-				return Message{}, fmt.Errorf("failed to read float64 Value: %v", err)
+			if entry.Ballot, err = readBallot(buf); err != nil {
+				return Message{}, err
 			}
-			payload.Value = floatValue
-		case STRING:
-			var strLen int64
-			if err := binary.Read(buf, binary.BigEndian, &strLen); err != nil {
-				return Message{}, fmt.Errorf("failed to read string length: %v", err)
+			if entry.Value, err = readValue(buf); err != nil {
+				return Message{}, err
 			}
-			strBytes := make([]byte, strLen)
-			if _, err := buf.Read(strBytes); err != nil {
-				return Message{}, fmt.Errorf("failed to read string Value: %v", err)
+			if entry.Fast, err = readBool(buf); err != nil {
+				return Message{}, fmt.Errorf("failed to read entry Fast: %v", err)
 			}
-			payload.Value = string(strBytes)
-		default:
-			return Message{}, fmt.Errorf("unsupported Value type identifier: %v", valueType)
+			payload.Entries = append(payload.Entries, entry)
+		}
+
+		// Read the EPaxos attributes
+		if err := binary.Read(buf, binary.BigEndian, &payload.Seq); err != nil {
+			return Message{}, fmt.Errorf("failed to read Seq: %v", err)
+		}
+		var depCount int64
+		if err := binary.Read(buf, binary.BigEndian, &depCount); err != nil {
+			return Message{}, fmt.Errorf("failed to read dependency count: %v", err)
+		}
+		for i := int64(0); i < depCount; i++ {
+			var dep InstanceRef
+			if err := binary.Read(buf, binary.BigEndian, &dep.Replica); err != nil {
+				return Message{}, fmt.Errorf("failed to read dependency replica: %v", err)
+			}
+			if err := binary.Read(buf, binary.BigEndian, &dep.Instance); err != nil {
+				return Message{}, fmt.Errorf("failed to read dependency instance: %v", err)
+			}
+			payload.Deps = append(payload.Deps, dep)
+		}
+
+		// Read the lease and confirmation attributes
+		if err := binary.Read(buf, binary.BigEndian, &payload.Request); err != nil {
+			return Message{}, fmt.Errorf("failed to read Request: %v", err)
+		}
+
+		// Read the compaction point
+		if err := binary.Read(buf, binary.BigEndian, &payload.Compacted); err != nil {
+			return Message{}, fmt.Errorf("failed to read Compacted: %v", err)
+		}
+
+		// Read the catch-up attributes
+		if err := binary.Read(buf, binary.BigEndian, &payload.UpTo); err != nil {
+			return Message{}, fmt.Errorf("failed to read UpTo: %v", err)
+		}
+		if err := binary.Read(buf, binary.BigEndian, &payload.Highest); err != nil {
+			return Message{}, fmt.Errorf("failed to read Highest: %v", err)
+		}
+
+		// Read the fast round marker
+		if payload.Fast, err = readBool(buf); err != nil {
+			return Message{}, fmt.Errorf("failed to read Fast: %v", err)
 		}
 	}
 
@@ -0,0 +1,176 @@
+package communication
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+	}{
+		{
+			name:    "empty payload fields",
+			message: Message{Header: MessageHeader{SenderID: 1, ProposerID: 2, MessageType: PREPARE}},
+		},
+		{
+			name: "scalar values",
+			message: Message{
+				Header:  MessageHeader{SenderID: 3, ProposerID: 1, MessageType: ACCEPT},
+				Payload: PaxosMessage{Slot: 7, Ballot: Ballot{Round: 4, HostID: 3}, Value: "x=1"},
+			},
+		},
+		{
+			name: "promise entries of every value type",
+			message: Message{
+				Header: MessageHeader{SenderID: 2, ProposerID: 1, MessageType: PROMISE},
+				Payload: PaxosMessage{
+					Slot:   5,
+					Ballot: Ballot{Round: 2, HostID: 1},
+					Entries: []LogEntry{
+						{Slot: 5, Ballot: Ballot{Round: 1, HostID: 1}, Value: int64(-42)},
+						{Slot: 6, Ballot: Ballot{Round: 1, HostID: 2}, Value: 3.5},
+						{Slot: 7, Ballot: Ballot{Round: 2, HostID: 1}, Value: nil},
+						{Slot: 8, Ballot: Ballot{Round: 2, HostID: 1}, Value: Batch{"a", int64(1), Command{Origin: 1, Seq: 9, Value: "b"}}},
+						{Slot: 9, Ballot: Ballot{Round: 2, HostID: 1}, Value: Noop{}},
+					},
+					Compacted: 5,
+				},
+			},
+		},
+		{
+			name: "fast round markers",
+			message: Message{
+				Header: MessageHeader{SenderID: 2, ProposerID: 1, MessageType: CATCHUP_REPLY},
+				Payload: PaxosMessage{
+					Ballot: Ballot{Round: 3, HostID: 1},
+					Fast:   true,
+					Entries: []LogEntry{
+						{Slot: 4, Ballot: Ballot{Round: 3, HostID: 1}, Value: Command{Origin: 2, Seq: 1, Value: "z"}, Fast: true},
+						{Slot: 5, Ballot: Ballot{Round: 4, HostID: 1}, Value: "w"},
+					},
+				},
+			},
+		},
+		{
+			name: "command",
+			message: Message{
+				Header:  MessageHeader{SenderID: 1, ProposerID: 1, MessageType: FORWARD},
+				Payload: PaxosMessage{Value: Command{Origin: 1, Seq: 1 << 40, Value: "y"}},
+			},
+		},
+		{
+			name: "epaxos attributes",
+			message: Message{
+				Header: MessageHeader{SenderID: 2, ProposerID: 1, MessageType: PRE_ACCEPT},
+				Payload: PaxosMessage{
+					Slot:  3,
+					Value: "k=v",
+					Seq:   12,
+					Deps:  []InstanceRef{{Replica: 1, Instance: 0}, {Replica: 3, Instance: 8}},
+				},
+			},
+		},
+		{
+			name: "lease and catch-up fields",
+			message: Message{
+				Header:  MessageHeader{SenderID: 4, ProposerID: 1, MessageType: CATCHUP_REPLY},
+				Payload: PaxosMessage{Slot: 10, Request: 6, Compacted: 9, UpTo: 110, Highest: 57},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ConvertToBinary(tt.message)
+			if err != nil {
+				t.Fatalf("ConvertToBinary: %v", err)
+			}
+			if len(data) < HeaderSize {
+				t.Fatalf("encoded %d bytes, shorter than the %d-byte header", len(data), HeaderSize)
+			}
+			if size := int64(binary.BigEndian.Uint64(data[24:HeaderSize])); size != int64(len(data)-HeaderSize) {
+				t.Errorf("header PayloadSize = %d, want %d", size, len(data)-HeaderSize)
+			}
+			got, err := ReadMessage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			want := tt.message
+			want.Header.PayloadSize = int64(len(data) - HeaderSize)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip =\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestConvertRejectsUnencodableValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "unsupported type", value: 3},
+		{name: "nested batch", value: Batch{Batch{"a"}}},
+		{name: "command holding a batch", value: Command{Origin: 1, Seq: 1, Value: Batch{"a"}}},
+		{name: "command holding a command", value: Command{Origin: 1, Seq: 1, Value: Command{Origin: 1, Seq: 2, Value: "a"}}},
+		{name: "command holding a no-op", value: Command{Origin: 1, Seq: 1, Value: Noop{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ConvertToBinary(Message{Payload: PaxosMessage{Value: tt.value}}); err == nil {
+				t.Errorf("ConvertToBinary(%v) succeeded, want an error", tt.value)
+			}
+		})
+	}
+}
+
+func TestReadMessageTruncated(t *testing.T) {
+	data, err := ConvertToBinary(Message{
+		Header:  MessageHeader{SenderID: 1, MessageType: ACCEPT},
+		Payload: PaxosMessage{Slot: 1, Value: "value"},
+	})
+	if err != nil {
+		t.Fatalf("ConvertToBinary: %v", err)
+	}
+	for _, size := range []int{0, HeaderSize - 1, HeaderSize, len(data) - 1} {
+		if _, err := ReadMessage(bytes.NewReader(data[:size])); err == nil {
+			t.Errorf("ReadMessage of %d of %d bytes succeeded, want an error", size, len(data))
+		}
+	}
+}
+
+func TestReadMessageInvalidLengths(t *testing.T) {
+	// The value follows the slot and the ballot, and its length follows its type indicator
+	lengthOffset := HeaderSize + 32
+	tests := []struct {
+		name   string
+		value  interface{}
+		offset int
+		length int64
+	}{
+		{name: "negative payload size", value: "value", offset: 24, length: -1},
+		{name: "huge payload size", value: "value", offset: 24, length: 1 << 62},
+		{name: "negative string length", value: "value", offset: lengthOffset, length: -8},
+		{name: "string longer than the payload", value: "value", offset: lengthOffset, length: 1 << 40},
+		{name: "negative batch length", value: Batch{"a", "b"}, offset: lengthOffset, length: -1},
+		{name: "batch longer than the payload", value: Batch{"a", "b"}, offset: lengthOffset, length: 1 << 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ConvertToBinary(Message{
+				Header:  MessageHeader{SenderID: 1, MessageType: ACCEPT},
+				Payload: PaxosMessage{Slot: 1, Value: tt.value},
+			})
+			if err != nil {
+				t.Fatalf("ConvertToBinary: %v", err)
+			}
+			binary.BigEndian.PutUint64(data[tt.offset:], uint64(tt.length))
+			if _, err := ReadMessage(bytes.NewReader(data)); err == nil {
+				t.Errorf("ReadMessage with length %d at offset %d succeeded, want an error", tt.length, tt.offset)
+			}
+		})
+	}
+}
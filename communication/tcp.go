@@ -10,11 +10,19 @@ import (
 
 const TCPPort = "8888"
 
+const (
+	dialTimeout    = 500 * time.Millisecond // How long a single connection attempt may take
+	redialInterval = 500 * time.Millisecond // How long to wait before dialing an unreachable peer again
+)
+
 type TcpCommunicator struct {
-	selfId      int64              // The ID of the current peer.
-	peers       map[int64]string   // Maps peer IDs to their hostnames.
-	connections map[int64]net.Conn // Maps peer IDs to their active TCP connections.
-	mu          sync.Mutex         // Mutex for thread-safe access to connections.
+	selfId      int64               // The ID of the current peer.
+	peers       map[int64]string    // Maps peer IDs to their hostnames.
+	connections map[int64]net.Conn  // Maps peer IDs to their active TCP connections.
+	dialFailed  map[int64]time.Time // When dialing each unreachable peer last failed.
+	incomingCh  chan Message        // Channel passed to Listen, used to deliver messages sent to this peer itself.
+	loopbackEnd chan struct{}       // Closed once the last message sent to this peer itself has been delivered.
+	mu          sync.Mutex          // Mutex for thread-safe access to connections.
 }
 
 func NewTcpCommunicator() *TcpCommunicator {
@@ -22,6 +30,7 @@ func NewTcpCommunicator() *TcpCommunicator {
 		selfId:      0,
 		peers:       make(map[int64]string),
 		connections: make(map[int64]net.Conn),
+		dialFailed:  make(map[int64]time.Time),
 	}
 }
 
@@ -39,47 +48,143 @@ func (c *TcpCommunicator) AddPeer(id int64, hostname string) {
 	c.peers[id] = hostname
 }
 
-// Tries to establish TCP connections to all peers until successful.
-func (c *TcpCommunicator) EstablishConnections(connectedCh chan bool) {
+// EstablishConnections tries to connect to all peers, and signals once every peer is connected or the timeout
+// has passed. A node restarting while some peers are down therefore does not block; peers that could not be
+// reached are dialed again when a message is next sent to them.
+func (c *TcpCommunicator) EstablishConnections(timeout time.Duration, connectedCh chan bool) {
 	var wg sync.WaitGroup
+	deadline := time.Now().Add(timeout)
 
 	for id, name := range c.peers {
 		wg.Add(1)
 		go func(id int64, name string) {
 			defer wg.Done()
-			for {
-				conn, err := net.Dial("tcp", fmt.Sprintf("%s:%s", name, TCPPort))
+			for time.Now().Before(deadline) {
+				conn, err := net.DialTimeout("tcp", net.JoinHostPort(name, TCPPort), dialTimeout)
 				if err == nil {
-					c.mu.Lock()
-					c.connections[id] = conn
-					c.mu.Unlock()
+					c.storeConnection(id, conn)
 					break
 				} else {
 					time.Sleep(500 * time.Millisecond)
 				}
-
 			}
 		}(id, name)
 	}
 
 	wg.Wait()
-	connectedCh <- true // Signal that all connections are established
+	connectedCh <- true // Signal that connecting is over, whether or not every peer answered
 }
 
-func (c *TcpCommunicator) sendMessage(id int64, message []byte) error { // int64ended to be private
+// storeConnection keeps conn as the connection to a peer and returns the connection to use. If another
+// connection was stored in the meantime, conn is closed in favour of it.
+func (c *TcpCommunicator) storeConnection(id int64, conn net.Conn) net.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, exists := c.connections[id]; exists {
+		conn.Close()
+		return existing
+	}
+	c.connections[id] = conn
+	delete(c.dialFailed, id)
+	return conn
+}
+
+// connection returns the connection to a peer, dialing it if there is none. After a failed attempt the peer
+// is not dialed again for redialInterval, so senders are not held up by a peer that is down.
+func (c *TcpCommunicator) connection(id int64) (net.Conn, error) {
 	c.mu.Lock()
 	conn, exists := c.connections[id]
+	name, known := c.peers[id]
+	failedAt, failed := c.dialFailed[id]
 	c.mu.Unlock()
 
-	if !exists {
-		log.Fatalf("no connection found for peer %v", id)
+	if exists {
+		return conn, nil
+	}
+	if !known {
+		return nil, fmt.Errorf("no connection found for peer %v", id)
+	}
+	if failed && time.Since(failedAt) < redialInterval {
+		return nil, fmt.Errorf("peer %v is unreachable", id)
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(name, TCPPort), dialTimeout)
+	if err != nil {
+		c.mu.Lock()
+		c.dialFailed[id] = time.Now()
+		c.mu.Unlock()
+		return nil, err
 	}
+	return c.storeConnection(id, conn), nil
+}
 
-	_, err := conn.Write(message)
-	return err
+// dropConnection closes a broken connection so that the next message to the peer dials it again.
+func (c *TcpCommunicator) dropConnection(id int64, conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connections[id] == conn {
+		delete(c.connections, id)
+	}
+	conn.Close()
+}
+
+func (c *TcpCommunicator) sendMessage(id int64, message []byte) error { // int64ended to be private
+	c.mu.Lock()
+	selfId, incomingCh := c.selfId, c.incomingCh
+	c.mu.Unlock()
+
+	if id == selfId && incomingCh != nil {
+		return c.deliverLocally(incomingCh, message)
+	}
+
+	conn, err := c.connection(id)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Write(message); err == nil {
+		return nil
+	}
+	// The peer may have restarted since the connection was opened, so retry once on a fresh connection
+	c.dropConnection(id, conn)
+	if conn, err = c.connection(id); err != nil {
+		return err
+	}
+	if _, err = conn.Write(message); err != nil {
+		c.dropConnection(id, conn)
+		return err
+	}
+	return nil
+}
+
+// deliverLocally hands a message addressed to this peer straight to the incoming channel. The message is
+// decoded from its wire form so local and remote deliveries look identical to the receiver, and it is
+// delivered asynchronously because the sender may itself be serving the incoming channel. Each delivery
+// waits for the previous one, so local messages keep their order like messages on a TCP connection.
+func (c *TcpCommunicator) deliverLocally(incomingCh chan Message, message []byte) error {
+	fullMessage, err := ConvertFromBinary(message)
+	if err != nil {
+		return fmt.Errorf("failed to convert from binary: %v", err)
+	}
+	c.mu.Lock()
+	previous := c.loopbackEnd
+	done := make(chan struct{})
+	c.loopbackEnd = done
+	c.mu.Unlock()
+
+	go func() {
+		if previous != nil {
+			<-previous
+		}
+		incomingCh <- fullMessage
+		close(done)
+	}()
+	return nil
 }
 
 func (c *TcpCommunicator) Listen(messageCh chan Message) {
+	c.mu.Lock()
+	c.incomingCh = messageCh
+	c.mu.Unlock()
+
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", TCPPort))
 	if err != nil {
 		log.Fatalf("Failed to start listener on port %s: %v\n", TCPPort, err)
@@ -96,7 +201,7 @@ func (c *TcpCommunicator) Listen(messageCh chan Message) {
 			defer conn.Close()
 			for {
 				// Read and parse the message
-				fullMessage, err := readAndParseMessage(conn)
+				fullMessage, err := ReadMessage(conn)
 				if err != nil {
 					fmt.Printf("Failed to read and parse message: %v\n", err)
 					break
@@ -108,17 +213,17 @@ func (c *TcpCommunicator) Listen(messageCh chan Message) {
 	}
 }
 
-func (c *TcpCommunicator) sendPaxosMessage(targetId int64, messageType int64, proposalNumber int64, value interface{}) error {
+// sendPaxosMessage sends a message to a peer host. proposerID names the proposer that sends a request or that a
+// reply is addressed to, so the receiving host can hand the message to the right one of its proposers.
+func (c *TcpCommunicator) sendPaxosMessage(targetId int64, proposerID int64, messageType int64, payload PaxosMessage) error {
 	message := Message{
 		Header: MessageHeader{
 			SenderID:    c.selfId,
+			ProposerID:  proposerID,
 			MessageType: messageType,
 			PayloadSize: 0, // Will be calculated in ConvertToBinary
 		},
-		Payload: PaxosMessage{
-			Proposal: proposalNumber,
-			Value:    value,
-		},
+		Payload: payload,
 	}
 	buf, err := ConvertToBinary(message)
 	if err != nil {
@@ -127,34 +232,225 @@ func (c *TcpCommunicator) sendPaxosMessage(targetId int64, messageType int64, pr
 	return c.sendMessage(targetId, buf)
 }
 
-func (c *TcpCommunicator) SendPrepareMessage(targetId int64, proposalNumber int64, value interface{}) error {
-	err := c.sendPaxosMessage(targetId, PREPARE, proposalNumber, value)
+// LogEvent prints a single protocol event in the JSON line format shared by all roles. proposal_num stays a bare
+// number, the round of the ballot; the proposer that owns the ballot and the slot follow as numeric fields of their
+// own, after the fields of the original format.
+func LogEvent(peerID int64, action string, messageType string, slot int64, value interface{}, ballot Ballot) {
+	fmt.Printf("{\"peer_id\": %v, \"action\": \"%v\", \"message_type\":\"%v\", \"message_value\":\"%v\", \"proposal_num\": %v, \"proposer_id\": %v, \"slot\": %v}\n",
+		peerID, action, messageType, value, ballot.Round, ballot.HostID, slot)
+}
+
+func (c *TcpCommunicator) SendPrepareMessage(targetId int64, proposerID int64, slot int64, ballot Ballot, value interface{}) error {
+	err := c.sendPaxosMessage(targetId, proposerID, PREPARE, PaxosMessage{Slot: slot, Ballot: ballot, Value: value})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "prepare", slot, value, ballot)
+	}
+	return err
+}
+
+func (c *TcpCommunicator) SendAcceptMessage(targetId int64, proposerID int64, slot int64, ballot Ballot, value interface{}) error {
+	err := c.sendPaxosMessage(targetId, proposerID, ACCEPT, PaxosMessage{Slot: slot, Ballot: ballot, Value: value})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "accept", slot, value, ballot)
+	}
+	return err
+}
+
+// SendAnyMessage opens a fast round: an Accept without a value, marked as fast, that lets the acceptor accept
+// values sent by clients under the ballot in the given slot and every later one.
+func (c *TcpCommunicator) SendAnyMessage(targetId int64, proposerID int64, slot int64, ballot Ballot) error {
+	err := c.sendPaxosMessage(targetId, proposerID, ACCEPT, PaxosMessage{Slot: slot, Ballot: ballot, Fast: true})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "accept", slot, nil, ballot)
+	}
+	return err
+}
+
+// SendPromiseMessage promises a ballot for every slot at or above fromSlot, returning the entries the acceptor has
+// already accepted in that range. compactedBelow is the slot below which the acceptor discarded its state, because
+// every value chosen there is included in a snapshot.
+func (c *TcpCommunicator) SendPromiseMessage(targetId int64, proposerID int64, fromSlot int64, promisedBallot Ballot, entries []LogEntry, compactedBelow int64) error {
+	err := c.sendPaxosMessage(targetId, proposerID, PROMISE, PaxosMessage{Slot: fromSlot, Ballot: promisedBallot, Entries: entries, Compacted: compactedBelow})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "prepare_ack", fromSlot, entries, promisedBallot)
+	}
+	return err
+}
+
+// SendAcceptedMessage reports a value accepted in a slot. fast marks a client value accepted in a fast round.
+func (c *TcpCommunicator) SendAcceptedMessage(targetId int64, proposerID int64, slot int64, promisedBallot Ballot, acceptedValue interface{}, fast bool) error {
+	err := c.sendPaxosMessage(targetId, proposerID, ACCEPTED, PaxosMessage{Slot: slot, Ballot: promisedBallot, Value: acceptedValue, Fast: fast})
 	if err == nil {
-		fmt.Printf("{\"peer_id\": %v, \"action\": \"%v\", \"message_type\":\"%v\", \"message_value\":\"%v\", \"proposal_num\": %v}\n", c.selfId, "sent", "prepare", value, proposalNumber)
+		LogEvent(c.selfId, "sent", "accept_ack", slot, acceptedValue, promisedBallot)
 	}
 	return err
 }
 
-func (c *TcpCommunicator) SendAcceptMessage(targetId int64, proposalNumber int64, value interface{}) error {
-	err := c.sendPaxosMessage(targetId, ACCEPT, proposalNumber, value)
+// SendPrepareNackMessage rejects a Prepare, reporting the higher ballot the acceptor has already promised.
+func (c *TcpCommunicator) SendPrepareNackMessage(targetId int64, proposerID int64, slot int64, promisedBallot Ballot) error {
+	err := c.sendPaxosMessage(targetId, proposerID, PREPARE_NACK, PaxosMessage{Slot: slot, Ballot: promisedBallot})
 	if err == nil {
-		fmt.Printf("{\"peer_id\": %v, \"action\": \"%v\", \"message_type\":\"%v\", \"message_value\":\"%v\", \"proposal_num\": %v}\n", c.selfId, "sent", "accept", value, proposalNumber)
+		LogEvent(c.selfId, "sent", "prepare_nack", slot, nil, promisedBallot)
 	}
 	return err
 }
 
-func (c *TcpCommunicator) SendPromiseMessage(targetId int64, acceptedProposal int64, acceptedValue interface{}) error {
-	err := c.sendPaxosMessage(targetId, PROMISE, acceptedProposal, acceptedValue)
+// SendAcceptNackMessage rejects an Accept, reporting the higher ballot the acceptor has already promised.
+func (c *TcpCommunicator) SendAcceptNackMessage(targetId int64, proposerID int64, slot int64, promisedBallot Ballot) error {
+	err := c.sendPaxosMessage(targetId, proposerID, ACCEPT_NACK, PaxosMessage{Slot: slot, Ballot: promisedBallot})
 	if err == nil {
-		fmt.Printf("{\"peer_id\": %v, \"action\": \"%v\", \"message_type\":\"%v\", \"message_value\":\"%v\", \"proposal_num\": %v}\n", c.selfId, "sent", "prepare_ack", acceptedValue, acceptedProposal)
+		LogEvent(c.selfId, "sent", "accept_nack", slot, nil, promisedBallot)
 	}
 	return err
 }
 
-func (c *TcpCommunicator) SendAcceptedMessage(targetId int64, acceptedProposal int64, acceptedValue interface{}) error {
-	err := c.sendPaxosMessage(targetId, ACCEPTED, acceptedProposal, acceptedValue)
+// SendHeartbeatMessage announces that the sender leads with the given ballot and is filling the given slot.
+func (c *TcpCommunicator) SendHeartbeatMessage(targetId int64, proposerID int64, slot int64, ballot Ballot) error {
+	return c.sendPaxosMessage(targetId, proposerID, HEARTBEAT, PaxosMessage{Slot: slot, Ballot: ballot})
+}
+
+// SendLeaseMessage asks an acceptor to grant the leader a lease for its ballot. request numbers the lease requests
+// of the leader, so that grants for an earlier one are not counted. Lease messages are too frequent to log.
+func (c *TcpCommunicator) SendLeaseMessage(targetId int64, proposerID int64, slot int64, ballot Ballot, request int64) error {
+	return c.sendPaxosMessage(targetId, proposerID, LEASE, PaxosMessage{Slot: slot, Ballot: ballot, Request: request})
+}
+
+// SendLeaseGrantMessage grants the leader with the given ballot the lease it asked for in request.
+func (c *TcpCommunicator) SendLeaseGrantMessage(targetId int64, proposerID int64, slot int64, ballot Ballot, request int64) error {
+	return c.sendPaxosMessage(targetId, proposerID, LEASE_GRANT, PaxosMessage{Slot: slot, Ballot: ballot, Request: request})
+}
+
+// SendConfirmMessage asks an acceptor to confirm that it has not promised a ballot above the leader's. request
+// numbers the confirmation rounds of the leader.
+func (c *TcpCommunicator) SendConfirmMessage(targetId int64, proposerID int64, slot int64, ballot Ballot, request int64) error {
+	err := c.sendPaxosMessage(targetId, proposerID, CONFIRM, PaxosMessage{Slot: slot, Ballot: ballot, Request: request})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "confirm", slot, nil, ballot)
+	}
+	return err
+}
+
+// SendConfirmOkMessage confirms the leader's ballot for confirmation round request.
+func (c *TcpCommunicator) SendConfirmOkMessage(targetId int64, proposerID int64, slot int64, ballot Ballot, request int64) error {
+	err := c.sendPaxosMessage(targetId, proposerID, CONFIRM_OK, PaxosMessage{Slot: slot, Ballot: ballot, Request: request})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "confirm_ok", slot, nil, ballot)
+	}
+	return err
+}
+
+// SendReleaseMessage tells an auxiliary acceptor that the main acceptors hold every value chosen below slot, so
+// it may discard its state for those slots.
+func (c *TcpCommunicator) SendReleaseMessage(targetId int64, proposerID int64, slot int64) error {
+	err := c.sendPaxosMessage(targetId, proposerID, RELEASE, PaxosMessage{Slot: slot})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "release", slot, nil, Ballot{})
+	}
+	return err
+}
+
+// SendCompactMessage hands an acceptor a snapshot that includes every slot up to lastSlot: the application state
+// after lastSlot and the reconfigurations chosen up to it. The acceptor stores it and discards its state below.
+func (c *TcpCommunicator) SendCompactMessage(targetId int64, proposerID int64, lastSlot int64, state interface{}, reconfigurations []LogEntry) error {
+	err := c.sendPaxosMessage(targetId, proposerID, COMPACT, PaxosMessage{Slot: lastSlot, Value: state, Entries: reconfigurations})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "compact", lastSlot, nil, Ballot{})
+	}
+	return err
+}
+
+// SendCatchUpMessage asks an acceptor for the entries it accepted in the slots from fromSlot up to, but not
+// including, toSlot.
+func (c *TcpCommunicator) SendCatchUpMessage(targetId int64, proposerID int64, fromSlot int64, toSlot int64) error {
+	err := c.sendPaxosMessage(targetId, proposerID, CATCHUP, PaxosMessage{Slot: fromSlot, UpTo: toSlot})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "catchup", fromSlot, nil, Ballot{})
+	}
+	return err
+}
+
+// SendCatchUpReplyMessage answers a catch-up request with the entries accepted in the range from fromSlot on.
+// highestSlot is the highest slot the acceptor accepted a value in, so the learner knows how far the log goes, and
+// compactedBelow is the slot below which the acceptor discarded its state.
+func (c *TcpCommunicator) SendCatchUpReplyMessage(targetId int64, proposerID int64, fromSlot int64, entries []LogEntry, highestSlot int64, compactedBelow int64) error {
+	err := c.sendPaxosMessage(targetId, proposerID, CATCHUP_REPLY, PaxosMessage{Slot: fromSlot, Entries: entries, Highest: highestSlot, Compacted: compactedBelow})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "catchup_reply", fromSlot, entries, Ballot{})
+	}
+	return err
+}
+
+// SendSnapshotMessage answers a catch-up request for slots an acceptor compacted with the snapshot that replaced
+// them, in the same fields as a Compact message.
+func (c *TcpCommunicator) SendSnapshotMessage(targetId int64, proposerID int64, lastSlot int64, state interface{}, reconfigurations []LogEntry) error {
+	err := c.sendPaxosMessage(targetId, proposerID, SNAPSHOT, PaxosMessage{Slot: lastSlot, Value: state, Entries: reconfigurations})
 	if err == nil {
-		fmt.Printf("{\"peer_id\": %v, \"action\": \"%v\", \"message_type\":\"%v\", \"message_value\":\"%v\", \"proposal_num\": %v}\n", c.selfId, "sent", "accept_ack", acceptedValue, acceptedProposal)
+		LogEvent(c.selfId, "sent", "snapshot", lastSlot, nil, Ballot{})
 	}
 	return err
 }
+
+// SendConfigureMessage tells a node that a reconfiguration was chosen in a slot.
+func (c *TcpCommunicator) SendConfigureMessage(targetId int64, proposerID int64, slot int64, value interface{}) error {
+	err := c.sendPaxosMessage(targetId, proposerID, CONFIGURE, PaxosMessage{Slot: slot, Value: value})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "configure", slot, value, Ballot{})
+	}
+	return err
+}
+
+// RemovePeer forgets a peer and closes the connection to it.
+func (c *TcpCommunicator) RemovePeer(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.peers, id)
+	delete(c.dialFailed, id)
+	if conn, exists := c.connections[id]; exists {
+		conn.Close()
+		delete(c.connections, id)
+	}
+}
+
+// SendForwardMessage hands a client value to the leader so that it is proposed there.
+func (c *TcpCommunicator) SendForwardMessage(targetId int64, proposerID int64, value interface{}) error {
+	err := c.sendPaxosMessage(targetId, proposerID, FORWARD, PaxosMessage{Value: value})
+	if err == nil {
+		LogEvent(c.selfId, "sent", "forward", 0, value, Ballot{})
+	}
+	return err
+}
+
+// sendEPaxosMessage sends an EPaxos message about an instance of the sender or the target. instanceID names
+// the numbered instance of the hostfile the replicas belong to, and travels in the ProposerID header field.
+func (c *TcpCommunicator) sendEPaxosMessage(targetId int64, instanceID int64, messageType int64, name string, slot int64, value interface{}, seq int64, deps []InstanceRef) error {
+	err := c.sendPaxosMessage(targetId, instanceID, messageType, PaxosMessage{Slot: slot, Value: value, Seq: seq, Deps: deps})
+	if err == nil {
+		LogEvent(c.selfId, "sent", name, slot, value, Ballot{})
+	}
+	return err
+}
+
+// SendPreAcceptMessage asks a replica to pre-accept a command in an instance of the sender.
+func (c *TcpCommunicator) SendPreAcceptMessage(targetId int64, instanceID int64, slot int64, command interface{}, seq int64, deps []InstanceRef) error {
+	return c.sendEPaxosMessage(targetId, instanceID, PRE_ACCEPT, "pre_accept", slot, command, seq, deps)
+}
+
+// SendPreAcceptOkMessage answers a PreAccept with the attributes merged with the replica's own conflicts.
+func (c *TcpCommunicator) SendPreAcceptOkMessage(targetId int64, instanceID int64, slot int64, seq int64, deps []InstanceRef) error {
+	return c.sendEPaxosMessage(targetId, instanceID, PRE_ACCEPT_OK, "pre_accept_ok", slot, nil, seq, deps)
+}
+
+// SendEPaxosAcceptMessage asks a replica to accept the final attributes of a command in an instance of the sender.
+func (c *TcpCommunicator) SendEPaxosAcceptMessage(targetId int64, instanceID int64, slot int64, command interface{}, seq int64, deps []InstanceRef) error {
+	return c.sendEPaxosMessage(targetId, instanceID, EPAXOS_ACCEPT, "epaxos_accept", slot, command, seq, deps)
+}
+
+// SendEPaxosAcceptOkMessage acknowledges an EPaxos Accept.
+func (c *TcpCommunicator) SendEPaxosAcceptOkMessage(targetId int64, instanceID int64, slot int64) error {
+	return c.sendEPaxosMessage(targetId, instanceID, EPAXOS_ACCEPT_OK, "epaxos_accept_ok", slot, nil, 0, nil)
+}
+
+// SendCommitMessage tells a replica that a command and its attributes are committed in an instance of the sender.
+func (c *TcpCommunicator) SendCommitMessage(targetId int64, instanceID int64, slot int64, command interface{}, seq int64, deps []InstanceRef) error {
+	return c.sendEPaxosMessage(targetId, instanceID, COMMIT, "commit", slot, command, seq, deps)
+}
@@ -2,74 +2,433 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"paxos/communication"
 	"paxos/paxosImpl"
 	"paxos/util"
+	"slices"
 	"time"
 )
 
 func main() {
-	hostfile, proposerValue, waitTime := util.ParseFlags()
-	hostRoles, quorumMap := util.ReadHostfile(hostfile)
+	config := util.ParseFlags()
+	hostRoles, quorumMap := util.ReadHostfile(config.Hostfile)
 	me, _ := os.Hostname()
 	communicator := communication.NewTcpCommunicator()
-	stateManager := paxosImpl.NewStateManager()
+	retryPolicy := paxosImpl.RetryPolicy{
+		PhaseTimeout: config.PhaseTimeout,
+		BackoffBase:  config.BackoffBase,
+		BackoffMax:   config.BackoffMax,
+		MaxAttempts:  config.MaxAttempts,
+	}
+	leaderPolicy := paxosImpl.LeaderPolicy{
+		HeartbeatInterval: config.Heartbeat,
+		ElectionTimeout:   config.Election,
+	}
+	batchPolicy := paxosImpl.BatchPolicy{
+		Window:  config.BatchWindow,
+		MaxSize: config.BatchSize,
+	}
+	leasePolicy := paxosImpl.LeasePolicy{
+		Duration: config.LeaseDuration,
+		Drift:    config.LeaseDrift,
+	}
+	// The leader renews its lease with every heartbeat
+	if err := leasePolicy.Validate(config.Heartbeat); err != nil {
+		log.Fatalf("invalid lease: %v", err)
+	}
+	newStateMachine, err := paxosImpl.LookupStateMachine(config.StateMachine)
+	if err != nil {
+		log.Fatalf("invalid state machine: %v", err)
+	}
+	fastMode := config.Mode == util.FastMode
+	epaxosMode := config.Mode == util.EPaxosMode
+	quorumPolicy := paxosImpl.QuorumPolicy{
+		Phase1: config.Phase1Quorum,
+		Phase2: config.Phase2Quorum,
+	}
+	// Reject quorum sizes that are unsafe for any instance of the cluster
+	for proposerID, acceptors := range quorumMap {
+		if err := quorumPolicy.Validate(len(acceptors) + len(util.AuxiliaryHosts(hostRoles, proposerID))); err != nil {
+			log.Fatalf("invalid quorums for %s%d: %v", util.ProposerRole, proposerID, err)
+		}
+	}
 
 	connectionsEstablishedCh := make(chan bool)
-	sendProposalCh := make(chan bool)
+	sendProposalCh := make(chan interface{})
+	readCh := make(chan paxosImpl.ReadRequest)
 	incomingMessagesCh := make(chan communication.Message)
-	prepareMessagesCh := make(chan communication.Message)
-	acceptMessagesCh := make(chan communication.Message)
-	promiseMessagesCh := make(chan communication.Message)
-	acceptedMessagesCh := make(chan communication.Message)
+	// Each numbered instance runs its own proposer, acceptor and learner, fed through their own channels
+	proposerInboxes := make(map[int64]paxosImpl.ProposerInbox)
+	acceptorInboxes := make(map[int64]acceptorInbox)
+	learnerInboxes := make(map[int64]chan communication.Message)
+	replicaInboxes := make(map[int64]chan communication.Message)
+	clientInboxes := make(map[int64]chan communication.Message)
 	go communicator.Listen(incomingMessagesCh)
 
+	var selfID int64
+	for id, info := range hostRoles {
+		if info.Hostname == me {
+			selfID = id
+		}
+	}
+	// A reconfiguration takes effect only after every slot that may be in flight when it is chosen, so the leader
+	// always knows the acceptor set of the slots it opens
+	reconfigDelay := max(config.ReconfigDelay, int64(config.PipelineWindow))
+	memberships := newMemberships(selfID, hostRoles, reconfigDelay, quorumPolicy, communicator)
+	// Every instance this host takes part in has its own replicated application, which all its roles apply to
+	appliers := make(map[int64]*paxosImpl.Applier)
+	applierOf := func(instance int64) *paxosImpl.Applier {
+		if _, exists := appliers[instance]; !exists {
+			appliers[instance] = paxosImpl.NewApplier(selfID, newStateMachine())
+		}
+		return appliers[instance]
+	}
+
 	for id, info := range hostRoles {
 		if info.Hostname == me {
 			communicator.SetSelfId(id)
-			if len(info.Proposer) > 0 {
-				for _, val := range info.Proposer {
-					// Initiate the proposer
-					proposer := paxosImpl.NewProposer(id, val-1, proposerValue, quorumMap[val], promiseMessagesCh, acceptedMessagesCh, sendProposalCh, communicator, stateManager)
-					go proposer.Listen()
+			if epaxosMode {
+				// EPaxos has no roles: every host of an instance runs a replica, which takes client commands itself
+				for _, val := range util.Instances(info) {
+					inbox := make(chan communication.Message)
+					replicaInboxes[val] = inbox
+					replica := paxosImpl.NewEPaxosReplica(id, val, util.ReplicaHosts(hostRoles, val), applierOf(val), retryPolicy, inbox, sendProposalCh, communicator)
+					go replica.Listen()
+				}
+				continue
+			}
+			for _, val := range info.Proposer {
+				proposerState := newProposerState(config.DataDir, id, val)
+				inbox := paxosImpl.NewProposerInbox(sendProposalCh, readCh)
+				if fastMode {
+					// Client values go straight to the acceptors, and only reach the proposer when forwarded
+					acceptedMessagesCh := make(chan communication.Message)
+					clientInboxes[val] = acceptedMessagesCh
+					client := paxosImpl.NewFastClient(id, val, memberships[val], util.AuxiliaryHosts(hostRoles, val), util.ProposerHosts(hostRoles, val),
+						quorumPolicy, config.PhaseTimeout, communicator, sendProposalCh, acceptedMessagesCh)
+					go client.Listen()
+					inbox.SendProposalCh = nil
+				}
+				proposerInboxes[val] = inbox
+				// Initiate the proposer
+				proposerConfig := paxosImpl.ProposerConfig{
+					ID:           id,
+					ProposerID:   val,
+					Auxiliaries:  util.AuxiliaryHosts(hostRoles, val),
+					Peers:        util.ProposerHosts(hostRoles, val),
+					QuorumPolicy: quorumPolicy,
+					FastMode:     fastMode,
+					RetryPolicy:  retryPolicy,
+					LeaderPolicy: leaderPolicy,
+					BatchPolicy:  batchPolicy,
+					Window:       config.PipelineWindow,
+					LeasePolicy:  leasePolicy,
+				}
+				proposer := paxosImpl.NewProposer(proposerConfig, memberships[val], applierOf(val), inbox, communicator, proposerState)
+				go proposer.Listen()
+			}
+			// Auxiliary acceptors run the same acceptor, which only hears from proposers while they are engaged
+			for _, val := range slices.Concat(info.Acceptor, info.Auxiliary) {
+				acceptorInboxes[val] = startAcceptor(id, val, hostRoles, config.DataDir, config.LeaseDuration, communicator)
+			}
+			for _, val := range info.Learner {
+				learnMessagesCh := make(chan communication.Message)
+				learnerInboxes[val] = learnMessagesCh
+				// Initiate the learner
+				snapshots := openSnapshotStore(config.DataDir, fmt.Sprintf("learner-%d-%d.snap", id, val))
+				learner, err := paxosImpl.NewLearner(id, val, memberships[val], util.AuxiliaryHosts(hostRoles, val), quorumPolicy,
+					applierOf(val), config.SnapshotSlots, snapshots, config.CatchUp, communicator, learnMessagesCh)
+				if err != nil {
+					log.Fatalf("failed to start learner: %v", err)
 				}
+				go learner.Listen()
 			}
-			// Initiate the acceptor
-			acceptor := paxosImpl.NewAcceptor(id, prepareMessagesCh, acceptMessagesCh, communicator, stateManager)
-			go acceptor.Listen()
-		} else {
+		} else if len(util.Instances(info)) > 0 {
+			// Spare hosts are only connected to once a reconfiguration adds them
 			communicator.AddPeer(id, info.Hostname)
 		}
 	}
 
 	// Establish connections before moving foward
-	go communicator.EstablishConnections(connectionsEstablishedCh)
+	go communicator.EstablishConnections(config.ConnectTimeout, connectionsEstablishedCh)
 	<-connectionsEstablishedCh
 
 	// Go through the proposers through channel and start the proposal
 	go func() {
-		time.Sleep(time.Duration(waitTime) * time.Second)
-		sendProposalCh <- true
+		// Every EPaxos replica and every Fast Paxos client takes commands, so only hosts given a value propose one
+		if (epaxosMode || fastMode) && config.ProposerValue == "" {
+			return
+		}
+		time.Sleep(time.Duration(config.TimeDelay) * time.Second)
+		sendProposalCh <- config.ProposerValue
 	}()
 
+	// Read the latest decided value through the local proposer, which answers if it leads
+	if config.ReadDelay >= 0 && len(proposerInboxes) > 0 {
+		go func() {
+			time.Sleep(time.Duration(config.ReadDelay * float64(time.Second)))
+			reply := make(chan paxosImpl.ReadResult, 1)
+			readCh <- paxosImpl.ReadRequest{Reply: reply}
+			result := <-reply
+			if result.Err != nil {
+				fmt.Printf("Failed to serve read: %v\n", result.Err)
+				return
+			}
+			messageType := "read_index"
+			if result.Lease {
+				messageType = "lease"
+			}
+			communication.LogEvent(selfID, "read", messageType, result.Slot, result.Value, result.Ballot)
+		}()
+	}
+
 	for message := range incomingMessagesCh {
 		var messageType string
 		switch message.Header.MessageType {
 		case communication.PREPARE:
 			messageType = "prepare"
-			prepareMessagesCh <- message
+			if _, exists := acceptorInboxes[message.Header.ProposerID]; !exists && !epaxosMode {
+				// A host added to the acceptor set by a reconfiguration starts its acceptor on the first Prepare
+				acceptorInboxes[message.Header.ProposerID] = startAcceptor(selfID, message.Header.ProposerID, hostRoles, config.DataDir, config.LeaseDuration, communicator)
+			}
+			if inbox, exists := acceptorInboxes[message.Header.ProposerID]; exists {
+				inbox.prepareMessagesCh <- message
+			}
 		case communication.PROMISE:
 			messageType = "prepare_ack"
-			promiseMessagesCh <- message
+			if inbox, exists := proposerInboxes[message.Header.ProposerID]; exists {
+				inbox.PromiseMessagesCh <- message
+			}
 		case communication.ACCEPT:
 			messageType = "accept"
-			acceptMessagesCh <- message
+			if inbox, exists := acceptorInboxes[message.Header.ProposerID]; exists {
+				inbox.acceptMessagesCh <- message
+			}
 		case communication.ACCEPTED:
 			messageType = "accept_ack"
-			acceptedMessagesCh <- message
+			if inbox, exists := proposerInboxes[message.Header.ProposerID]; exists {
+				inbox.AcceptedMessagesCh <- message
+			}
+			if learnMessagesCh, exists := learnerInboxes[message.Header.ProposerID]; exists {
+				learnMessagesCh <- message
+			}
+			if acceptedMessagesCh, exists := clientInboxes[message.Header.ProposerID]; exists {
+				acceptedMessagesCh <- message
+			}
+		case communication.PREPARE_NACK:
+			messageType = "prepare_nack"
+			if inbox, exists := proposerInboxes[message.Header.ProposerID]; exists {
+				inbox.NackMessagesCh <- message
+			}
+		case communication.ACCEPT_NACK:
+			messageType = "accept_nack"
+			if inbox, exists := proposerInboxes[message.Header.ProposerID]; exists {
+				inbox.NackMessagesCh <- message
+			}
+		case communication.HEARTBEAT:
+			// Heartbeats are too frequent to log
+			if inbox, exists := proposerInboxes[message.Header.ProposerID]; exists {
+				inbox.HeartbeatMessagesCh <- message
+			}
+			continue
+		case communication.FORWARD:
+			messageType = "forward"
+			if inbox, exists := proposerInboxes[message.Header.ProposerID]; exists {
+				inbox.ForwardMessagesCh <- message
+			}
+		case communication.LEASE:
+			// Lease requests and grants come with every heartbeat and are not logged either
+			if inbox, exists := acceptorInboxes[message.Header.ProposerID]; exists {
+				inbox.leaseMessagesCh <- message
+			}
+			continue
+		case communication.LEASE_GRANT:
+			if inbox, exists := proposerInboxes[message.Header.ProposerID]; exists {
+				inbox.LeaseMessagesCh <- message
+			}
+			continue
+		case communication.CONFIRM:
+			messageType = "confirm"
+			if inbox, exists := acceptorInboxes[message.Header.ProposerID]; exists {
+				inbox.leaseMessagesCh <- message
+			}
+		case communication.CONFIRM_OK:
+			messageType = "confirm_ok"
+			if inbox, exists := proposerInboxes[message.Header.ProposerID]; exists {
+				inbox.LeaseMessagesCh <- message
+			}
+		case communication.CONFIGURE:
+			messageType = "configure"
+			if membership, exists := memberships[message.Header.ProposerID]; exists {
+				membership.Apply(message.Payload.Slot, message.Payload.Value)
+			}
+		case communication.RELEASE:
+			messageType = "release"
+			if inbox, exists := acceptorInboxes[message.Header.ProposerID]; exists {
+				inbox.releaseMessagesCh <- message
+			}
+		case communication.COMPACT:
+			messageType = "compact"
+			if inbox, exists := acceptorInboxes[message.Header.ProposerID]; exists {
+				inbox.releaseMessagesCh <- message
+			}
+		case communication.CATCHUP:
+			messageType = "catchup"
+			if inbox, exists := acceptorInboxes[message.Header.ProposerID]; exists {
+				inbox.catchUpMessagesCh <- message
+			}
+		case communication.CATCHUP_REPLY, communication.SNAPSHOT:
+			messageType = "catchup_reply"
+			if message.Header.MessageType == communication.SNAPSHOT {
+				messageType = "snapshot"
+			}
+			if learnMessagesCh, exists := learnerInboxes[message.Header.ProposerID]; exists {
+				learnMessagesCh <- message
+			}
+		case communication.PRE_ACCEPT, communication.PRE_ACCEPT_OK, communication.EPAXOS_ACCEPT, communication.EPAXOS_ACCEPT_OK, communication.COMMIT:
+			messageType = epaxosMessageTypes[message.Header.MessageType]
+			if inbox, exists := replicaInboxes[message.Header.ProposerID]; exists {
+				inbox <- message
+			}
+		}
+		var value interface{} = message.Payload.Value
+		switch message.Header.MessageType {
+		case communication.PROMISE, communication.CATCHUP_REPLY:
+			value = message.Payload.Entries
+		case communication.COMPACT, communication.SNAPSHOT:
+			// Snapshots carry the whole application state, which is left out of the log
+			value = nil
+		}
+		communication.LogEvent(message.Header.SenderID, "received", messageType, message.Payload.Slot, value, message.Payload.Ballot)
+	}
+}
+
+// epaxosMessageTypes names the EPaxos message types in the log.
+var epaxosMessageTypes = map[int64]string{
+	communication.PRE_ACCEPT:       "pre_accept",
+	communication.PRE_ACCEPT_OK:    "pre_accept_ok",
+	communication.EPAXOS_ACCEPT:    "epaxos_accept",
+	communication.EPAXOS_ACCEPT_OK: "epaxos_accept_ok",
+	communication.COMMIT:           "commit",
+}
+
+// acceptorInbox holds the channels through which the dispatcher hands requests to the acceptor of one instance.
+type acceptorInbox struct {
+	prepareMessagesCh chan communication.Message
+	acceptMessagesCh  chan communication.Message
+	releaseMessagesCh chan communication.Message
+	leaseMessagesCh   chan communication.Message
+	catchUpMessagesCh chan communication.Message
+}
+
+// startAcceptor starts the acceptor of an instance on this host and returns its inbox.
+func startAcceptor(id int64, instance int64, hostRoles map[int64]util.HostInfo, dataDir string, leaseDuration time.Duration,
+	communicator *communication.TcpCommunicator) acceptorInbox {
+	stateManager := newStateManager(dataDir, id, instance)
+	inbox := acceptorInbox{
+		prepareMessagesCh: make(chan communication.Message),
+		acceptMessagesCh:  make(chan communication.Message),
+		releaseMessagesCh: make(chan communication.Message),
+		leaseMessagesCh:   make(chan communication.Message),
+		catchUpMessagesCh: make(chan communication.Message),
+	}
+	// Initiate the acceptor
+	acceptor := paxosImpl.NewAcceptor(id, util.LearnerHosts(hostRoles, instance), inbox.prepareMessagesCh, inbox.acceptMessagesCh,
+		inbox.releaseMessagesCh, inbox.leaseMessagesCh, inbox.catchUpMessagesCh, leaseDuration, communicator, stateManager,
+		openSnapshotStore(dataDir, fmt.Sprintf("acceptor-%d-%d.snap", id, instance)))
+	go acceptor.Listen()
+	return inbox
+}
+
+// newMemberships creates the membership of every instance in the hostfile, starting from its acceptors there. As
+// reconfigurations are applied, hosts joining an acceptor set are connected to, and hosts left without any role
+// are disconnected from.
+func newMemberships(selfID int64, hostRoles map[int64]util.HostInfo, reconfigDelay int64, quorumPolicy paxosImpl.QuorumPolicy,
+	communicator *communication.TcpCommunicator) map[int64]*paxosImpl.Membership {
+	memberships := make(map[int64]*paxosImpl.Membership)
+	needed := func(hostID int64) bool {
+		info := hostRoles[hostID]
+		if len(info.Proposer) > 0 || len(info.Learner) > 0 || len(info.Auxiliary) > 0 {
+			return true
 		}
-		fmt.Printf("{\"peer_id\": %v, \"action\": \"%v\", \"message_type\":\"%v\", \"message_value\":\"%v\", \"proposal_num\": %v}\n", message.Header.SenderID, "received", messageType, message.Payload.Value, message.Payload.Proposal)
+		for _, membership := range memberships {
+			if slices.Contains(membership.Latest(), hostID) {
+				return true
+			}
+		}
+		return false
+	}
+	onChange := func(added, removed []int64) {
+		for _, hostID := range added {
+			info, known := hostRoles[hostID]
+			if !known {
+				fmt.Printf("Host %v joined an acceptor set but is not in the hostfile\n", hostID)
+				continue
+			}
+			if hostID != selfID {
+				communicator.AddPeer(hostID, info.Hostname)
+			}
+		}
+		for _, hostID := range removed {
+			if hostID != selfID && !needed(hostID) {
+				communicator.RemovePeer(hostID)
+			}
+		}
+	}
+	for _, info := range hostRoles {
+		for _, instance := range util.Instances(info) {
+			if _, exists := memberships[instance]; !exists {
+				memberships[instance] = paxosImpl.NewMembership(selfID, util.AcceptorHosts(hostRoles, instance), reconfigDelay, quorumPolicy,
+					len(util.AuxiliaryHosts(hostRoles, instance)), onChange)
+			}
+		}
+	}
+	return memberships
+}
+
+// openWriteAheadLog opens the named write-ahead log in dataDir. An empty dataDir disables persistence and
+// returns nil.
+func openWriteAheadLog(dataDir string, name string) *paxosImpl.WriteAheadLog {
+	if dataDir == "" {
+		return nil
+	}
+	wal, err := paxosImpl.OpenWriteAheadLog(filepath.Join(dataDir, name))
+	if err != nil {
+		log.Fatalf("failed to open write-ahead log: %v", err)
+	}
+	return wal
+}
+
+// openSnapshotStore returns the named snapshot store in dataDir, next to the write-ahead logs. An empty dataDir
+// disables persistence and returns nil.
+func openSnapshotStore(dataDir string, name string) *paxosImpl.SnapshotStore {
+	if dataDir == "" {
+		return nil
+	}
+	snapshots, err := paxosImpl.NewSnapshotStore(filepath.Join(dataDir, name))
+	if err != nil {
+		log.Fatalf("failed to open snapshot store: %v", err)
+	}
+	return snapshots
+}
+
+// newStateManager restores the state of one acceptor instance of this host from its write-ahead log in dataDir.
+func newStateManager(dataDir string, id int64, instance int64) *paxosImpl.StateManager {
+	stateManager, err := paxosImpl.NewStateManager(openWriteAheadLog(dataDir, fmt.Sprintf("acceptor-%d-%d.wal", id, instance)))
+	if err != nil {
+		log.Fatalf("failed to restore acceptor state: %v", err)
+	}
+	return stateManager
+}
 
+// newProposerState restores the highest ballot issued by a proposer of this host from its write-ahead log in dataDir.
+func newProposerState(dataDir string, id int64, proposerID int64) *paxosImpl.ProposerState {
+	proposerState, err := paxosImpl.NewProposerState(openWriteAheadLog(dataDir, fmt.Sprintf("proposer-%d-%d.wal", id, proposerID)))
+	if err != nil {
+		log.Fatalf("failed to restore proposer ballot: %v", err)
 	}
+	return proposerState
 }
@@ -1,27 +1,63 @@
 package paxosImpl
 
 import (
+	"fmt"
 	"paxos/communication"
+	"slices"
+	"time"
 )
 
 type Acceptor struct {
 	id                int64                          // Unique ID for the Acceptor
+	learners          []int64                        // Host IDs of the learners notified of accepted values
 	stateManager      *StateManager                  // StateManager to manage shared state
 	tcpCommunicator   *communication.TcpCommunicator // Communicator to send and receive messages
 	prepareMessagesCh chan communication.Message     // Channel to receive Prepare messages
 	acceptMessagesCh  chan communication.Message     // Channel to receive Accept messages
+	releaseMessagesCh chan communication.Message     // Channel to receive Release messages, sent to auxiliary acceptors only, and snapshots from learners
+	leaseMessagesCh   chan communication.Message     // Channel to receive lease requests and confirmation requests from the leader
+	catchUpMessagesCh chan communication.Message     // Channel to receive catch-up requests from learners
+	anyBallot         communication.Ballot           // Fast ballot under which client values may be accepted, zero when none
+	anyFrom           int64                          // First slot open to client values under anyBallot
+	leaseDuration     time.Duration                  // How long a granted lease lasts, 0 when leases are disabled
+	leaseHolder       int64                          // Host ID of the proposer holding the lease, -1 when unknown after a restart
+	leaseExpiry       time.Time                      // When the granted lease ends
+	snapshot          *Snapshot                      // The latest snapshot handed over by a learner, nil when none
+	snapshots         *SnapshotStore                 // Durable copy of the snapshot next to the write-ahead log, nil keeps it in memory only
 }
 
-// NewAcceptor initializes a new Acceptor instance.
-func NewAcceptor(id int64, prepareMessagesCh chan communication.Message,
-	acceptMessagesCh chan communication.Message, tcpCommunicator *communication.TcpCommunicator, stateManager *StateManager) *Acceptor {
-	return &Acceptor{
+// NewAcceptor initializes a new Acceptor instance. With leases enabled, an acceptor that promised anything before
+// it restarted refuses every proposer for one lease duration. The snapshot kept in the store is loaded back; a
+// corrupt one is dropped, since the acceptor state itself lives in the write-ahead log.
+func NewAcceptor(id int64, learners []int64, prepareMessagesCh chan communication.Message, acceptMessagesCh chan communication.Message,
+	releaseMessagesCh chan communication.Message, leaseMessagesCh chan communication.Message, catchUpMessagesCh chan communication.Message,
+	leaseDuration time.Duration, tcpCommunicator *communication.TcpCommunicator, stateManager *StateManager, snapshots *SnapshotStore) *Acceptor {
+	a := &Acceptor{
 		id:                id,
+		learners:          learners,
 		stateManager:      stateManager,
 		tcpCommunicator:   tcpCommunicator,
 		prepareMessagesCh: prepareMessagesCh,
 		acceptMessagesCh:  acceptMessagesCh,
+		releaseMessagesCh: releaseMessagesCh,
+		leaseMessagesCh:   leaseMessagesCh,
+		catchUpMessagesCh: catchUpMessagesCh,
+		leaseDuration:     leaseDuration,
+		snapshots:         snapshots,
 	}
+	if snapshots != nil {
+		snapshot, found, err := snapshots.Load()
+		if err != nil {
+			fmt.Printf("Ignoring stored snapshot: %v\n", err)
+		} else if found {
+			a.snapshot = &snapshot
+		}
+	}
+	if leaseDuration > 0 && !stateManager.GetMinProposalFrom(0).IsZero() {
+		a.leaseHolder = -1
+		a.leaseExpiry = time.Now().Add(leaseDuration)
+	}
+	return a
 }
 
 func (a *Acceptor) Listen() {
@@ -31,32 +67,140 @@ func (a *Acceptor) Listen() {
 			a.handlePrepareMessage(message)
 		case message := <-a.acceptMessagesCh:
 			a.handleAcceptMessage(message)
+		case message := <-a.releaseMessagesCh:
+			if message.Header.MessageType == communication.COMPACT {
+				a.handleCompactMessage(message)
+			} else {
+				a.handleReleaseMessage(message)
+			}
+		case message := <-a.leaseMessagesCh:
+			if message.Header.MessageType == communication.CONFIRM {
+				a.handleConfirmMessage(message)
+			} else {
+				a.handleLeaseMessage(message)
+			}
+		case message := <-a.catchUpMessagesCh:
+			a.handleCatchUpMessage(message)
 		}
 	}
 }
 
-// handlePrepareMessage processes a Prepare message.
+// handlePrepareMessage processes a Prepare message, which covers every slot at or above the message slot.
 func (a *Acceptor) handlePrepareMessage(message communication.Message) {
-	// Check if the proposal is greater than the current min proposal
-	if message.Payload.Proposal > a.stateManager.GetMinProposal() {
-		a.stateManager.UpdateState(&message.Payload.Proposal, nil, nil)
+	fromSlot := message.Payload.Slot
+	// Another proposer's lease must run out before this one can gather promises
+	if a.leased(message.Payload.Ballot) {
+		communication.LogEvent(a.id, "refused", "lease", fromSlot, nil, message.Payload.Ballot)
+		return
 	}
-	err := a.tcpCommunicator.SendPromiseMessage(message.Header.SenderID, a.stateManager.GetMinProposal(), a.stateManager.GetAcceptedValue())
+	// Reject the ballot unless it is greater than every min proposal in the range
+	minProposal := a.stateManager.GetMinProposalFrom(fromSlot)
+	if !message.Payload.Ballot.GreaterThan(minProposal) {
+		err := a.tcpCommunicator.SendPrepareNackMessage(message.Header.SenderID, message.Header.ProposerID, fromSlot, minProposal)
+		if err != nil {
+			fmt.Printf("Failed to send prepare_nack to peer %v: %v\n", message.Header.SenderID, err)
+		}
+		return
+	}
+	// The promise must be durable before it is sent
+	if err := a.stateManager.UpdatePromise(fromSlot, message.Payload.Ballot); err != nil {
+		fmt.Printf("Failed to persist promise, not replying: %v\n", err)
+		return
+	}
+	// The proposer learns where the state ends, since slots compacted away are reported as if nothing was accepted
+	entries := a.stateManager.GetAcceptedFrom(fromSlot)
+	err := a.tcpCommunicator.SendPromiseMessage(message.Header.SenderID, message.Header.ProposerID, fromSlot, message.Payload.Ballot, entries,
+		a.stateManager.DiscardedBelow())
 	if err != nil {
-		panic(err.Error())
+		fmt.Printf("Failed to send prepare_ack to peer %v: %v\n", message.Header.SenderID, err)
 	}
-
 }
 
-// handleAcceptMessage processes an Accept message.
+// handleAcceptMessage processes an Accept message for a single slot. In Fast Paxos mode an Accept marked as fast
+// opens a fast round, and an Accept with the zero ballot carries a value sent directly by a client.
 func (a *Acceptor) handleAcceptMessage(message communication.Message) {
-	// Check if the proposal is greater than or equal to the current min proposal
-	if message.Payload.Proposal >= a.stateManager.GetMinProposal() {
-		a.stateManager.UpdateState(&message.Payload.Proposal, &message.Payload.Proposal, &message.Payload.Value)
+	switch {
+	case message.Payload.Ballot.IsZero():
+		a.handleClientValue(message)
+		return
+	case message.Payload.Fast:
+		a.handleAnyMessage(message)
+		return
 	}
-	minProposal := a.stateManager.GetMinProposal()
-	err := a.tcpCommunicator.SendAcceptedMessage(message.Header.SenderID, minProposal, nil)
-	if err != nil {
-		panic(err.Error())
+	slot := message.Payload.Slot
+	// Reject the ballot unless it is greater than or equal to the current min proposal of the slot
+	minProposal := a.stateManager.GetMinProposal(slot)
+	if !message.Payload.Ballot.AtLeast(minProposal) {
+		err := a.tcpCommunicator.SendAcceptNackMessage(message.Header.SenderID, message.Header.ProposerID, slot, minProposal)
+		if err != nil {
+			fmt.Printf("Failed to send accept_nack to peer %v: %v\n", message.Header.SenderID, err)
+		}
+		return
+	}
+	a.acceptValue(message, slot, message.Payload.Ballot, message.Payload.Value, false)
+}
+
+// acceptValue accepts a value in a slot under a ballot and notifies the sender, the learners, the proposer owning the
+// ballot and the origin of every command in the value. A client value is sent by the client, so the leader that
+// opened the fast round learns of it through the ballot, and the client learns of the fate of its commands through
+// their origin, even when a classic round proposes them again. fast marks a client value accepted in a fast round,
+// both in the acceptor state and in the notifications, since it takes a fast quorum to choose it.
+func (a *Acceptor) acceptValue(message communication.Message, slot int64, ballot communication.Ballot, value interface{}, fast bool) {
+	// Slots whose state was discarded were decided long ago, and accepting again would bring the state back
+	if slot < a.stateManager.DiscardedBelow() {
+		return
+	}
+	// The accepted value must be durable before anyone is told about it
+	if err := a.stateManager.UpdateState(slot, &ballot, &ballot, &value, &fast); err != nil {
+		fmt.Printf("Failed to persist accepted value, not replying: %v\n", err)
+		return
+	}
+
+	// Send a single copy to hosts that play several of these roles
+	targets := slices.Concat([]int64{message.Header.SenderID, ballot.HostID}, a.learners)
+	for _, command := range communication.Commands(value) {
+		if c, ok := command.(communication.Command); ok {
+			targets = append(targets, c.Origin)
+		}
+	}
+	slices.Sort(targets)
+	targets = slices.Compact(targets)
+	for _, targetID := range targets {
+		err := a.tcpCommunicator.SendAcceptedMessage(targetID, message.Header.ProposerID, slot, ballot, value, fast)
+		if err != nil {
+			fmt.Printf("Failed to send accept_ack to peer %v: %v\n", targetID, err)
+		}
+	}
+}
+
+// handleReleaseMessage discards the state an auxiliary acceptor kept while it was engaged. The main acceptors hold
+// every value chosen below the released slot, so the auxiliary only needs its state from there on.
+func (a *Acceptor) handleReleaseMessage(message communication.Message) {
+	if err := a.stateManager.Discard(message.Payload.Slot); err != nil {
+		fmt.Printf("Failed to discard state below slot %v: %v\n", message.Payload.Slot, err)
+		return
+	}
+	communication.LogEvent(a.id, "released", "release", message.Payload.Slot, nil, communication.Ballot{})
+}
+
+// handleCompactMessage stores a snapshot taken by a learner and discards the state of every slot it includes, which
+// were all chosen. Snapshots no newer than the stored one are ignored.
+func (a *Acceptor) handleCompactMessage(message communication.Message) {
+	snapshot := snapshotFromPayload(message.Payload)
+	if a.snapshot != nil && snapshot.LastSlot <= a.snapshot.LastSlot {
+		return
+	}
+	// The snapshot must be durable before the state it replaces is discarded
+	if a.snapshots != nil {
+		if err := a.snapshots.Save(snapshot); err != nil {
+			fmt.Printf("Failed to save snapshot of slot %v: %v\n", snapshot.LastSlot, err)
+			return
+		}
+	}
+	a.snapshot = &snapshot
+	if err := a.stateManager.Discard(snapshot.LastSlot + 1); err != nil {
+		fmt.Printf("Failed to discard state below slot %v: %v\n", snapshot.LastSlot+1, err)
+		return
 	}
+	communication.LogEvent(a.id, "compacted", "compact", snapshot.LastSlot, nil, communication.Ballot{})
 }
@@ -0,0 +1,99 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"paxos/communication"
+	"sync"
+)
+
+// Applier applies the chosen commands of one instance to the state machine of the node, in slot order. Every role
+// of the host that learns chosen values delivers them here: the leading proposer, the learner, and in EPaxos mode
+// the replica, in its execution order. Each slot is applied once, by whichever role delivers it first, and a slot
+// delivered out of order waits for the slots below it.
+type Applier struct {
+	id           int64                 // Host ID of the node, for the log
+	stateMachine StateMachine          // The application the chosen commands are applied to
+	next         int64                 // The lowest slot not applied yet
+	delivered    map[int64]interface{} // Values delivered for slots above next, waiting for the slots below them
+	mu           sync.Mutex            // Mutex serializing deliveries from the roles of the host
+}
+
+// NewApplier returns an applier that applies commands to stateMachine from slot 0 on.
+func NewApplier(id int64, stateMachine StateMachine) *Applier {
+	return &Applier{
+		id:           id,
+		stateMachine: stateMachine,
+		delivered:    make(map[int64]interface{}),
+	}
+}
+
+// Deliver hands over the value chosen in a slot, which is applied once every slot below it is. The commands of a
+// batch are applied one by one with the slot of the batch, and each result is reported. Reconfigurations only
+// change the membership, which the roles apply themselves, so they reach the state machine as empty slots. Slots
+// already applied are ignored.
+func (a *Applier) Deliver(slot int64, value interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if slot < a.next {
+		return
+	}
+	a.delivered[slot] = value
+	a.applyDelivered()
+}
+
+// applyDelivered applies the delivered slots from the lowest one not applied up to the first gap. The caller must
+// hold a.mu.
+func (a *Applier) applyDelivered() {
+	for {
+		value, ok := a.delivered[a.next]
+		if !ok {
+			return
+		}
+		delete(a.delivered, a.next)
+		if _, ok := ParseReconfiguration(value); !ok {
+			for _, command := range communication.Commands(value) {
+				result := a.stateMachine.Apply(a.next, communication.CommandValue(command))
+				communication.LogEvent(a.id, "applied", "apply", a.next, result, communication.Ballot{})
+			}
+		}
+		a.next++
+	}
+}
+
+// Applied returns the last slot applied, -1 when none.
+func (a *Applier) Applied() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.next - 1
+}
+
+// State returns the last slot applied, -1 when none, together with the state of the state machine after it.
+func (a *Applier) State() (int64, interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.next - 1, a.stateMachine.Snapshot()
+}
+
+// Restore resumes from a snapshot that includes slots not applied yet: the state machine is restored from the
+// snapshot's state, the slots it includes count as applied, and the slots delivered after it follow. A snapshot
+// the state machine is already past is ignored. Nothing changes if the state machine cannot restore the state.
+func (a *Applier) Restore(snapshot Snapshot) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if snapshot.LastSlot < a.next {
+		return nil
+	}
+	if err := a.stateMachine.Restore(snapshot.State); err != nil {
+		return fmt.Errorf("failed to restore state machine from snapshot of slot %v: %v", snapshot.LastSlot, err)
+	}
+	for slot := range a.delivered {
+		if slot <= snapshot.LastSlot {
+			delete(a.delivered, slot)
+		}
+	}
+	a.next = snapshot.LastSlot + 1
+	a.applyDelivered()
+	return nil
+}
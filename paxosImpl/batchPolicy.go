@@ -0,0 +1,62 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"slices"
+	"time"
+)
+
+// BatchPolicy controls how the leader gathers queued client commands into a single value.
+type BatchPolicy struct {
+	Window  time.Duration // How long the leader waits for more commands before proposing a batch that is not full
+	MaxSize int           // Most commands proposed together in one slot, 1 or less disables batching
+}
+
+// nextValue returns the value to propose from the head of the queue: a batch of up to MaxSize commands, or the
+// head itself when batching is off or only one command is queued. Reconfigurations are always proposed alone, so
+// that each slot changes the acceptor set at most once. The caller must hold p.mu.
+func (p *Proposer) nextValue() interface{} {
+	size := 0
+	for size < len(p.pending) && size < max(p.batchPolicy.MaxSize, 1) {
+		if _, ok := ParseReconfiguration(p.pending[size]); ok {
+			if size == 0 {
+				size = 1
+			}
+			break
+		}
+		size++
+	}
+	if size <= 1 {
+		return p.pending[0]
+	}
+	return communication.Batch(slices.Clone(p.pending[:size]))
+}
+
+// dequeue removes the commands of a value from the queue, if they are queued there in a row, and reports whether
+// they were. They are usually at the head, except for values recovered in Phase 1 above a slot the queue fills.
+// Commands are matched by identity, so an equal command submitted again, or proposed by another proposer, stays
+// queued. A no-op carries no command and is never queued. The caller must hold p.mu.
+func (p *Proposer) dequeue(value interface{}) bool {
+	commands := communication.Commands(value)
+	if len(commands) == 0 {
+		return false
+	}
+	for start := 0; start+len(commands) <= len(p.pending); start++ {
+		if slices.EqualFunc(commands, p.pending[start:start+len(commands)], communication.SameCommand) {
+			p.pending = slices.Delete(p.pending, start, start+len(commands))
+			return true
+		}
+	}
+	return false
+}
+
+// waitForBatch holds back a batch that is not full yet for the batch window, so that more commands can join it.
+// It reports whether the leader is now waiting. The caller must hold p.mu.
+func (p *Proposer) waitForBatch() bool {
+	if p.batchPolicy.Window <= 0 || len(p.pending) >= p.batchPolicy.MaxSize {
+		return false
+	}
+	p.phase = phaseBatch
+	p.resetTimer(p.batchPolicy.Window)
+	return true
+}
@@ -0,0 +1,123 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"paxos/communication"
+	"slices"
+)
+
+// catchUpBatch is the most slots a learner asks for in one catch-up request.
+const catchUpBatch = 100
+
+// handleCatchUpMessage sends a learner the entries accepted in the requested range. Slots below the compaction point
+// are no longer kept one by one, so the snapshot that replaced them is sent first, and the entries follow from the
+// slot after it. An acceptor that discarded the requested slots without a snapshot, such as a released auxiliary
+// acceptor, sends no entries at all; the compaction point in its reply tells the learner to look elsewhere.
+func (a *Acceptor) handleCatchUpMessage(message communication.Message) {
+	target, instance := message.Header.SenderID, message.Header.ProposerID
+	fromSlot, toSlot := message.Payload.Slot, message.Payload.UpTo
+	discarded := a.stateManager.DiscardedBelow()
+	if fromSlot < discarded && a.snapshot != nil && a.snapshot.LastSlot >= fromSlot {
+		err := a.tcpCommunicator.SendSnapshotMessage(target, instance, a.snapshot.LastSlot, a.snapshot.State, a.snapshot.Reconfigurations)
+		if err != nil {
+			fmt.Printf("Failed to send snapshot to peer %v: %v\n", target, err)
+			return
+		}
+		fromSlot = a.snapshot.LastSlot + 1
+	}
+	accepted := a.stateManager.GetAcceptedFrom(fromSlot)
+	highestSlot := fromSlot - 1
+	if len(accepted) > 0 {
+		highestSlot = accepted[len(accepted)-1].Slot
+	}
+	entries := []communication.LogEntry{}
+	for _, entry := range accepted {
+		if fromSlot >= discarded && entry.Slot < toSlot {
+			entries = append(entries, entry)
+		}
+	}
+	err := a.tcpCommunicator.SendCatchUpReplyMessage(target, instance, fromSlot, entries, highestSlot, discarded)
+	if err != nil {
+		fmt.Printf("Failed to send catchup_reply to peer %v: %v\n", target, err)
+	}
+}
+
+// handleCatchUpTick asks the acceptors for the slots the learner is missing. A learner that just started does not
+// know how far the log goes, so it asks once for the slots after its snapshot. Afterwards it asks whenever the
+// lowest slot not applied did not move since the previous tick although later slots received votes.
+func (l *Learner) handleCatchUpTick() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stalled := l.next == l.progressMark && l.next <= l.highest
+	l.progressMark = l.next
+	if !l.probed || stalled {
+		l.requestCatchUp()
+	}
+}
+
+// requestCatchUp asks every acceptor that may hold the missing slots for the entries it accepted in them, up to
+// catchUpBatch slots from the lowest slot not applied. Acceptors that reported discarding the lowest missing slot
+// without a snapshot are left out while others remain. When none remain, all of them are asked again, since any of
+// them may have stored a snapshot in the meantime and then sends it. The caller must hold l.mu.
+func (l *Learner) requestCatchUp() {
+	toSlot := l.next + catchUpBatch
+	if l.probed {
+		toSlot = min(toSlot, l.highest+1)
+	}
+	targets := slices.Concat(l.membership.Acceptors(l.next), l.membership.Latest(), l.auxiliaries)
+	slices.Sort(targets)
+	targets = slices.Compact(targets)
+	serving := slices.DeleteFunc(slices.Clone(targets), func(acceptorID int64) bool { return l.compactedAt[acceptorID] > l.next })
+	if len(serving) > 0 {
+		targets = serving
+	}
+	for _, acceptorID := range targets {
+		err := l.tcpCommunicator.SendCatchUpMessage(acceptorID, l.instance, l.next, toSlot)
+		if err != nil {
+			fmt.Printf("Failed to send catchup to peer %v: %v\n", acceptorID, err)
+			continue
+		}
+		l.probed = true
+	}
+	l.requestedTo = toSlot
+}
+
+// handleCatchUpReplyMessage counts the entries an acceptor reported as its votes, and remembers where the acceptor's
+// state starts. A slot is learned once a quorum reported the same value under the same ballot, exactly as with
+// Accepted notifications. A slot whose votes are split across ballots is learned once the leader finishes it.
+func (l *Learner) handleCatchUpReplyMessage(message communication.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.highest = max(l.highest, message.Payload.Highest)
+	l.reportedEnd = max(l.reportedEnd, message.Payload.Highest)
+	l.compactedAt[message.Header.SenderID] = message.Payload.Compacted
+	for _, entry := range message.Payload.Entries {
+		l.countVote(entry.Slot, message.Header.SenderID, entry.Ballot, entry.Value, entry.Fast)
+	}
+}
+
+// handleSnapshotMessage installs a snapshot sent by an acceptor in place of slots it compacted, when it includes
+// slots the learner has not applied yet. Once the state machine restored it, the snapshot is made durable like one
+// the learner took itself; a learner that fails to save it catches up again after a restart.
+func (l *Learner) handleSnapshotMessage(message communication.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	snapshot := snapshotFromPayload(message.Payload)
+	if snapshot.LastSlot < l.next {
+		return
+	}
+	if err := l.restore(snapshot); err != nil {
+		fmt.Printf("Failed to install snapshot: %v\n", err)
+		return
+	}
+	if l.snapshots != nil {
+		if err := l.snapshots.Save(snapshot); err != nil {
+			fmt.Printf("Failed to save snapshot of slot %v: %v\n", snapshot.LastSlot, err)
+		}
+	}
+	l.highest = max(l.highest, snapshot.LastSlot)
+	l.apply()
+}
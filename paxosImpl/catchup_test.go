@@ -0,0 +1,110 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"reflect"
+	"testing"
+)
+
+// catchUpReplyFrom returns the reply of an acceptor to a catch-up request with the entries it accepted.
+func catchUpReplyFrom(acceptorID int64, highest int64, compacted int64, entries ...communication.LogEntry) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{SenderID: acceptorID, ProposerID: 1, MessageType: communication.CATCHUP_REPLY},
+		Payload: communication.PaxosMessage{Entries: entries, Highest: highest, Compacted: compacted},
+	}
+}
+
+// snapshotFrom returns a snapshot an acceptor sends in place of the slots up to lastSlot.
+func snapshotFrom(acceptorID int64, lastSlot int64) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{SenderID: acceptorID, ProposerID: 1, MessageType: communication.SNAPSHOT},
+		Payload: communication.PaxosMessage{Slot: lastSlot},
+	}
+}
+
+func TestLearnerCatchUp(t *testing.T) {
+	ballot := communication.Ballot{Round: 1, HostID: 1}
+	a := communication.LogEntry{Slot: 0, Ballot: ballot, Value: "a"}
+	b := communication.LogEntry{Slot: 1, Ballot: ballot, Value: "b"}
+	c := communication.LogEntry{Slot: 2, Ballot: ballot, Value: "c"}
+	tests := []struct {
+		name     string
+		messages []communication.Message
+		applied  []interface{}
+		wantNext int64 // Lowest slot the learner has not applied afterwards
+	}{
+		{
+			name:     "entries reported by a quorum",
+			messages: []communication.Message{catchUpReplyFrom(2, 1, 0, a, b), catchUpReplyFrom(3, 1, 0, a, b)},
+			applied:  []interface{}{"a", "b"},
+			wantNext: 2,
+		},
+		{
+			name:     "entries reported by one acceptor",
+			messages: []communication.Message{catchUpReplyFrom(2, 1, 0, a, b)},
+			wantNext: 0,
+		},
+		{
+			name: "replies and Accepted notifications add up",
+			messages: []communication.Message{
+				catchUpReplyFrom(2, 0, 0, a), acceptedVote(3, 0, ballot, "a", false),
+			},
+			applied:  []interface{}{"a"},
+			wantNext: 1,
+		},
+		{
+			name: "snapshot of compacted slots before the entries",
+			messages: []communication.Message{
+				snapshotFrom(2, 1), catchUpReplyFrom(2, 2, 2, c), catchUpReplyFrom(3, 2, 2, c),
+			},
+			applied:  []interface{}{"c"},
+			wantNext: 3,
+		},
+		{
+			name: "snapshot of slots already applied",
+			messages: []communication.Message{
+				catchUpReplyFrom(2, 1, 0, a, b), catchUpReplyFrom(3, 1, 0, a, b), snapshotFrom(2, 0),
+			},
+			applied:  []interface{}{"a", "b"},
+			wantNext: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, stateMachine := newTestLearner()
+			for _, message := range tt.messages {
+				switch message.Header.MessageType {
+				case communication.CATCHUP_REPLY:
+					l.handleCatchUpReplyMessage(message)
+				case communication.SNAPSHOT:
+					l.handleSnapshotMessage(message)
+				default:
+					l.handleAcceptedMessage(message)
+				}
+			}
+			if !reflect.DeepEqual(stateMachine.commands, tt.applied) {
+				t.Errorf("applied %v, want %v", stateMachine.commands, tt.applied)
+			}
+			if l.next != tt.wantNext {
+				t.Errorf("next slot %v, want %v", l.next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestLearnerCatchUpTick(t *testing.T) {
+	ballot := communication.Ballot{Round: 1, HostID: 1}
+	l, _ := newTestLearner()
+	l.probed = true
+
+	l.handleCatchUpTick()
+	if l.requestedTo != 0 {
+		t.Fatalf("asked for slots up to %v with no later slot voted on, want no request", l.requestedTo)
+	}
+	// The learner missed slot 0, and hears of slot 1 from a single vote
+	l.handleAcceptedMessage(acceptedVote(2, 1, ballot, "b", false))
+	l.handleCatchUpTick()
+	if l.requestedTo != 2 {
+		t.Errorf("asked for slots up to %v once stalled, want up to slot 2", l.requestedTo)
+	}
+}
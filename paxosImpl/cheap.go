@@ -0,0 +1,101 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"paxos/communication"
+	"slices"
+)
+
+// unreplicatedSlot is a slot chosen with the votes of auxiliary acceptors, along with the main acceptors that have
+// not accepted its value yet.
+type unreplicatedSlot struct {
+	value   interface{}
+	missing map[int64]bool
+}
+
+// acceptors returns the acceptors a round is sent to: the main acceptors, plus the auxiliary ones while they are
+// engaged. The caller must hold p.mu.
+func (p *Proposer) acceptors() []int64 {
+	if !p.auxEngaged {
+		return p.mainAcceptors()
+	}
+	return slices.Concat(p.mainAcceptors(), p.auxiliaries)
+}
+
+// engageAuxiliaries sends later rounds to the auxiliary acceptors as well. It is called when a phase times out,
+// which is how an unreachable main acceptor shows. The caller must hold p.mu.
+func (p *Proposer) engageAuxiliaries() {
+	if len(p.auxiliaries) == 0 || p.auxEngaged {
+		return
+	}
+	p.auxEngaged = true
+	p.mainSeen = make(map[int64]bool)
+	communication.LogEvent(p.id, "engaged", "auxiliary", p.slot, nil, p.state.Ballot())
+}
+
+// observeAcceptor notes that a main acceptor answered while the auxiliaries are engaged. The caller must hold p.mu.
+func (p *Proposer) observeAcceptor(acceptorID int64) {
+	if p.auxEngaged && slices.Contains(p.mainAcceptors(), acceptorID) {
+		p.mainSeen[acceptorID] = true
+	}
+}
+
+// recordUnreplicated remembers a slot that was just chosen if some main acceptor is not among those that accepted
+// its value. The caller must hold p.mu.
+func (p *Proposer) recordUnreplicated(slot int64, value interface{}, accepted map[int64]bool) {
+	if !p.auxEngaged {
+		return
+	}
+	missing := make(map[int64]bool)
+	for _, acceptorID := range p.mainAcceptors() {
+		if !accepted[acceptorID] {
+			missing[acceptorID] = true
+		}
+	}
+	if len(missing) > 0 {
+		p.unreplicated[slot] = &unreplicatedSlot{value: value, missing: missing}
+	}
+}
+
+// replicateToMain sends the value of every slot chosen with auxiliary votes to the main acceptors that have not
+// accepted it yet. The leader calls it on every heartbeat until they all have. The caller must hold p.mu.
+func (p *Proposer) replicateToMain() {
+	ballot := p.state.Ballot()
+	for slot, entry := range p.unreplicated {
+		for acceptorID := range entry.missing {
+			// An unreachable acceptor is tried again on the next heartbeat
+			_ = p.tcpCommunicator.SendAcceptMessage(acceptorID, p.proposerID, slot, ballot, entry.value)
+		}
+	}
+}
+
+// handleReplicationAccepted handles an Accepted message for a slot that replicateToMain re-sent, and reports
+// whether the message was one. The caller must hold p.mu.
+func (p *Proposer) handleReplicationAccepted(message communication.Message) bool {
+	entry, exists := p.unreplicated[message.Payload.Slot]
+	if _, inflight := p.inflight[message.Payload.Slot]; !exists || inflight {
+		return false
+	}
+	delete(entry.missing, message.Header.SenderID)
+	if len(entry.missing) == 0 {
+		delete(p.unreplicated, message.Payload.Slot)
+	}
+	p.releaseAuxiliaries()
+	return true
+}
+
+// releaseAuxiliaries goes back to the main acceptors once every one of them has answered again and holds every
+// value chosen with auxiliary votes. The auxiliaries are then told to discard their state below the current slot.
+// The caller must hold p.mu.
+func (p *Proposer) releaseAuxiliaries() {
+	if !p.auxEngaged || len(p.unreplicated) > 0 || len(p.mainSeen) < len(p.mainAcceptors()) {
+		return
+	}
+	p.auxEngaged = false
+	communication.LogEvent(p.id, "released", "auxiliary", p.slot, nil, p.state.Ballot())
+	for _, auxiliaryID := range p.auxiliaries {
+		if err := p.tcpCommunicator.SendReleaseMessage(auxiliaryID, p.proposerID, p.slot); err != nil {
+			fmt.Printf("Failed to send release to peer %v: %v\n", auxiliaryID, err)
+		}
+	}
+}
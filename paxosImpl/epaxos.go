@@ -0,0 +1,373 @@
+package paxosImpl
+
+import (
+	"cmp"
+	"fmt"
+	"paxos/communication"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Status of an EPaxos instance, in the order an instance moves through them.
+const (
+	statusPreAccepted = iota + 1
+	statusAccepted
+	statusCommitted
+	statusExecuted
+)
+
+// epaxosInstance is a replica's view of one EPaxos instance.
+type epaxosInstance struct {
+	command      interface{}                        // The command proposed in the instance
+	seq          int64                              // Sequence number breaking ties between commands in a dependency cycle
+	deps         map[communication.InstanceRef]bool // Conflicting instances the command must execute after
+	status       int                                // How far the instance has progressed at this replica
+	preAcceptOks map[int64]bool                     // Replicas that answered the PreAccept, on the command leader only
+	acceptOks    map[int64]bool                     // Replicas that answered the Accept, on the command leader only
+	changed      bool                               // A PreAcceptOK reported attributes the command leader did not propose
+	startedAt    time.Time                          // When the command leader started the current phase
+}
+
+// EPaxosReplica runs Egalitarian Paxos for one numbered instance of the hostfile. There is no leader: every replica
+// proposes client commands in its own instance space and commits them in one round trip when no conflicting
+// command is in flight, or in two otherwise. It replaces the proposer, acceptor and learner of the instance.
+//
+// Limitation: explicit prepare is not implemented. Only the command leader ever drives an instance, with no ballot,
+// so an instance whose leader crashes before committing it stays uncommitted for good, and every command that
+// depends on it, directly or not, never executes on any replica. The mode tolerates slow replicas, not crashed ones.
+type EPaxosReplica struct {
+	id              int64                                         // Host ID of the replica, which owns the instance space of the same ID
+	instanceID      int64                                         // Number of the hostfile instance the replica belongs to
+	replicas        []int64                                       // Host IDs of every replica of the instance, including this one
+	fastReplies     int                                           // Matching PreAcceptOK replies needed to commit on the fast path
+	slowReplies     int                                           // Replies needed to commit through the Accept phase
+	nextSlot        int64                                         // Next free instance number of the replica's own instance space
+	instances       map[communication.InstanceRef]*epaxosInstance // Every instance the replica knows about
+	conflicts       map[interface{}]map[int64]int64               // Highest instance of each replica touching each key
+	maxSeq          map[interface{}]int64                         // Highest sequence number of the commands touching each key
+	executed        int64                                         // Commands executed so far, the position of the next one
+	applier         *Applier                                      // Applies the executed commands to the state machine of the node, in execution order
+	retryPolicy     RetryPolicy                                   // Only PhaseTimeout is used, to resend unanswered messages
+	tcpCommunicator *communication.TcpCommunicator                // Communicator to send and receive messages
+	messagesCh      chan communication.Message                    // Channel to receive EPaxos messages
+	sendProposalCh  chan interface{}                              // Channel to receive client commands
+}
+
+// NewEPaxosReplica initializes a replica. With N replicas, commands commit on the fast path once
+// F + ⌊(F+1)/2⌋ replicas, counting the command leader and never fewer than a majority, report the same
+// attributes, where F = ⌊(N-1)/2⌋. The Accept phase needs a majority.
+func NewEPaxosReplica(id int64, instanceID int64, replicas []int64, applier *Applier, retryPolicy RetryPolicy, messagesCh chan communication.Message,
+	sendProposalCh chan interface{}, tcpCommunicator *communication.TcpCommunicator) *EPaxosReplica {
+	majority := len(replicas)/2 + 1
+	f := (len(replicas) - 1) / 2
+	return &EPaxosReplica{
+		id:              id,
+		instanceID:      instanceID,
+		replicas:        replicas,
+		fastReplies:     max(majority, f+(f+1)/2) - 1,
+		slowReplies:     majority - 1,
+		instances:       make(map[communication.InstanceRef]*epaxosInstance),
+		conflicts:       make(map[interface{}]map[int64]int64),
+		maxSeq:          make(map[interface{}]int64),
+		applier:         applier,
+		retryPolicy:     retryPolicy,
+		tcpCommunicator: tcpCommunicator,
+		messagesCh:      messagesCh,
+		sendProposalCh:  sendProposalCh,
+	}
+}
+
+func (r *EPaxosReplica) Listen() {
+	retryTicker := time.NewTicker(r.retryPolicy.PhaseTimeout)
+	defer retryTicker.Stop()
+	for {
+		select {
+		case command := <-r.sendProposalCh:
+			r.propose(command)
+		case message := <-r.messagesCh:
+			switch message.Header.MessageType {
+			case communication.PRE_ACCEPT:
+				r.handlePreAcceptMessage(message)
+			case communication.PRE_ACCEPT_OK:
+				r.handlePreAcceptOkMessage(message)
+			case communication.EPAXOS_ACCEPT:
+				r.handleAcceptMessage(message)
+			case communication.EPAXOS_ACCEPT_OK:
+				r.handleAcceptOkMessage(message)
+			case communication.COMMIT:
+				r.handleCommitMessage(message)
+			}
+		case <-retryTicker.C:
+			r.handleRetryTick()
+		}
+	}
+}
+
+// conflictKey returns the key a command touches. Commands conflict, and must execute in the same order on every
+// replica, when they touch the same key. A string command "k=v" writes the key k, and any other command is its
+// own key, so equal commands conflict and different ones commute.
+func conflictKey(command interface{}) interface{} {
+	if s, ok := command.(string); ok {
+		if key, _, found := strings.Cut(s, "="); found {
+			return key
+		}
+	}
+	return command
+}
+
+// propose starts a command in the next instance of the replica's own space, with attributes computed from the
+// conflicting commands it knows about, and sends a PreAccept to every other replica.
+func (r *EPaxosReplica) propose(command interface{}) {
+	ref := communication.InstanceRef{Replica: r.id, Instance: r.nextSlot}
+	r.nextSlot++
+	seq, deps := r.attributes(command, ref, 0, nil)
+	instance := &epaxosInstance{
+		command:      command,
+		seq:          seq,
+		deps:         deps,
+		status:       statusPreAccepted,
+		preAcceptOks: make(map[int64]bool),
+		startedAt:    time.Now(),
+	}
+	r.instances[ref] = instance
+	r.recordConflict(command, ref, seq)
+
+	if r.fastReplies == 0 {
+		r.commit(ref, instance)
+		return
+	}
+	r.sendToOthers(instance.preAcceptOks, func(replicaID int64) error {
+		return r.tcpCommunicator.SendPreAcceptMessage(replicaID, r.instanceID, ref.Instance, command, instance.seq, sortedDeps(instance.deps))
+	})
+}
+
+// attributes merges the proposed sequence number and dependencies of a command with the conflicting instances
+// known to this replica.
+func (r *EPaxosReplica) attributes(command interface{}, ref communication.InstanceRef, seq int64, proposed []communication.InstanceRef) (int64, map[communication.InstanceRef]bool) {
+	key := conflictKey(command)
+	deps := make(map[communication.InstanceRef]bool)
+	for _, dep := range proposed {
+		deps[dep] = true
+	}
+	// The highest conflicting instance of each replica covers the lower ones, which it depends on in turn
+	for replicaID, instance := range r.conflicts[key] {
+		dep := communication.InstanceRef{Replica: replicaID, Instance: instance}
+		if dep != ref {
+			deps[dep] = true
+		}
+	}
+	if len(r.conflicts[key]) > 0 {
+		seq = max(seq, r.maxSeq[key]+1)
+	}
+	return seq, deps
+}
+
+// recordConflict remembers that an instance touches the key of its command.
+func (r *EPaxosReplica) recordConflict(command interface{}, ref communication.InstanceRef, seq int64) {
+	key := conflictKey(command)
+	if r.conflicts[key] == nil {
+		r.conflicts[key] = make(map[int64]int64)
+	}
+	if highest, exists := r.conflicts[key][ref.Replica]; !exists || ref.Instance > highest {
+		r.conflicts[key][ref.Replica] = ref.Instance
+	}
+	r.maxSeq[key] = max(r.maxSeq[key], seq)
+}
+
+// handlePreAcceptMessage pre-accepts a command of another replica and replies with its attributes, updated with
+// the conflicting instances this replica knows about.
+func (r *EPaxosReplica) handlePreAcceptMessage(message communication.Message) {
+	ref := communication.InstanceRef{Replica: message.Header.SenderID, Instance: message.Payload.Slot}
+	instance, exists := r.instances[ref]
+	if !exists {
+		seq, deps := r.attributes(message.Payload.Value, ref, message.Payload.Seq, message.Payload.Deps)
+		instance = &epaxosInstance{
+			command: message.Payload.Value,
+			seq:     seq,
+			deps:    deps,
+			status:  statusPreAccepted,
+		}
+		r.instances[ref] = instance
+		r.recordConflict(instance.command, ref, seq)
+	}
+	// A resent PreAccept gets the attributes reported the first time
+	err := r.tcpCommunicator.SendPreAcceptOkMessage(ref.Replica, r.instanceID, ref.Instance, instance.seq, sortedDeps(instance.deps))
+	if err != nil {
+		fmt.Printf("Failed to send pre_accept_ok to peer %v: %v\n", ref.Replica, err)
+	}
+}
+
+// handlePreAcceptOkMessage collects the attributes reported for a command of this replica. The command commits
+// on the fast path once enough replicas agree with the proposed attributes. Otherwise their union goes through
+// the Accept phase as soon as a majority replied.
+func (r *EPaxosReplica) handlePreAcceptOkMessage(message communication.Message) {
+	ref := communication.InstanceRef{Replica: r.id, Instance: message.Payload.Slot}
+	instance, exists := r.instances[ref]
+	if !exists || instance.status != statusPreAccepted {
+		return
+	}
+	instance.preAcceptOks[message.Header.SenderID] = true
+	if message.Payload.Seq > instance.seq {
+		instance.seq = message.Payload.Seq
+		instance.changed = true
+	}
+	for _, dep := range message.Payload.Deps {
+		if !instance.deps[dep] {
+			instance.deps[dep] = true
+			instance.changed = true
+		}
+	}
+
+	switch {
+	case !instance.changed && len(instance.preAcceptOks) >= r.fastReplies:
+		r.recordConflict(instance.command, ref, instance.seq)
+		r.commit(ref, instance)
+	case instance.changed && len(instance.preAcceptOks) >= r.slowReplies:
+		r.startAccept(ref, instance)
+	}
+}
+
+// startAccept runs the Accept phase for the final attributes of a command of this replica.
+func (r *EPaxosReplica) startAccept(ref communication.InstanceRef, instance *epaxosInstance) {
+	instance.status = statusAccepted
+	instance.acceptOks = make(map[int64]bool)
+	instance.startedAt = time.Now()
+	r.recordConflict(instance.command, ref, instance.seq)
+
+	if r.slowReplies == 0 {
+		r.commit(ref, instance)
+		return
+	}
+	r.sendToOthers(instance.acceptOks, func(replicaID int64) error {
+		return r.tcpCommunicator.SendEPaxosAcceptMessage(replicaID, r.instanceID, ref.Instance, instance.command, instance.seq, sortedDeps(instance.deps))
+	})
+}
+
+// handleAcceptMessage accepts the final attributes of a command of another replica.
+func (r *EPaxosReplica) handleAcceptMessage(message communication.Message) {
+	ref := communication.InstanceRef{Replica: message.Header.SenderID, Instance: message.Payload.Slot}
+	if instance, exists := r.instances[ref]; !exists || instance.status < statusAccepted {
+		r.storeInstance(ref, message.Payload, statusAccepted)
+	}
+	err := r.tcpCommunicator.SendEPaxosAcceptOkMessage(ref.Replica, r.instanceID, ref.Instance)
+	if err != nil {
+		fmt.Printf("Failed to send epaxos_accept_ok to peer %v: %v\n", ref.Replica, err)
+	}
+}
+
+// handleAcceptOkMessage commits a command of this replica once a majority accepted its attributes.
+func (r *EPaxosReplica) handleAcceptOkMessage(message communication.Message) {
+	ref := communication.InstanceRef{Replica: r.id, Instance: message.Payload.Slot}
+	instance, exists := r.instances[ref]
+	if !exists || instance.status != statusAccepted {
+		return
+	}
+	instance.acceptOks[message.Header.SenderID] = true
+	if len(instance.acceptOks) >= r.slowReplies {
+		r.commit(ref, instance)
+	}
+}
+
+// commit marks a command of this replica as committed, tells every other replica and executes what it can.
+func (r *EPaxosReplica) commit(ref communication.InstanceRef, instance *epaxosInstance) {
+	instance.status = statusCommitted
+	communication.LogEvent(r.id, "committed", "commit", ref.Instance, instance.command, communication.Ballot{Round: instance.seq, HostID: ref.Replica})
+	deps := sortedDeps(instance.deps)
+	for _, replicaID := range r.replicas {
+		if replicaID == r.id {
+			continue
+		}
+		err := r.tcpCommunicator.SendCommitMessage(replicaID, r.instanceID, ref.Instance, instance.command, instance.seq, deps)
+		if err != nil {
+			fmt.Printf("Failed to send commit to peer %v: %v\n", replicaID, err)
+		}
+	}
+	r.execute()
+}
+
+// handleCommitMessage records a command committed by another replica and executes what it can.
+func (r *EPaxosReplica) handleCommitMessage(message communication.Message) {
+	ref := communication.InstanceRef{Replica: message.Header.SenderID, Instance: message.Payload.Slot}
+	if instance, exists := r.instances[ref]; exists && instance.status >= statusCommitted {
+		return
+	}
+	r.storeInstance(ref, message.Payload, statusCommitted)
+	r.execute()
+}
+
+// storeInstance replaces the attributes of an instance of another replica with those carried by a message.
+func (r *EPaxosReplica) storeInstance(ref communication.InstanceRef, payload communication.PaxosMessage, status int) *epaxosInstance {
+	deps := make(map[communication.InstanceRef]bool)
+	for _, dep := range payload.Deps {
+		deps[dep] = true
+	}
+	instance := &epaxosInstance{
+		command: payload.Value,
+		seq:     payload.Seq,
+		deps:    deps,
+		status:  status,
+	}
+	r.instances[ref] = instance
+	r.recordConflict(instance.command, ref, instance.seq)
+	return instance
+}
+
+// handleRetryTick resends the current phase of the commands of this replica that have waited longer than the
+// phase timeout to the replicas that have not answered. A command that has a majority of PreAcceptOK replies but
+// cannot reach the fast path moves on to the Accept phase instead.
+func (r *EPaxosReplica) handleRetryTick() {
+	now := time.Now()
+	for ref, instance := range r.instances {
+		if ref.Replica != r.id || now.Sub(instance.startedAt) < r.retryPolicy.PhaseTimeout {
+			continue
+		}
+		switch instance.status {
+		case statusPreAccepted:
+			communication.LogEvent(r.id, "timeout", "pre_accept", ref.Instance, instance.command, communication.Ballot{})
+			if len(instance.preAcceptOks) >= r.slowReplies {
+				r.startAccept(ref, instance)
+				continue
+			}
+			instance.startedAt = now
+			r.sendToOthers(instance.preAcceptOks, func(replicaID int64) error {
+				return r.tcpCommunicator.SendPreAcceptMessage(replicaID, r.instanceID, ref.Instance, instance.command, instance.seq, sortedDeps(instance.deps))
+			})
+		case statusAccepted:
+			communication.LogEvent(r.id, "timeout", "epaxos_accept", ref.Instance, instance.command, communication.Ballot{})
+			instance.startedAt = now
+			r.sendToOthers(instance.acceptOks, func(replicaID int64) error {
+				return r.tcpCommunicator.SendEPaxosAcceptMessage(replicaID, r.instanceID, ref.Instance, instance.command, instance.seq, sortedDeps(instance.deps))
+			})
+		}
+	}
+}
+
+// sendToOthers sends a message to every other replica that has not answered yet.
+func (r *EPaxosReplica) sendToOthers(answered map[int64]bool, send func(replicaID int64) error) {
+	for _, replicaID := range r.replicas {
+		if replicaID == r.id || answered[replicaID] {
+			continue
+		}
+		if err := send(replicaID); err != nil {
+			fmt.Printf("Failed to send to peer %v: %v\n", replicaID, err)
+		}
+	}
+}
+
+// sortedDeps returns a dependency set in a deterministic order for the wire.
+func sortedDeps(deps map[communication.InstanceRef]bool) []communication.InstanceRef {
+	sorted := make([]communication.InstanceRef, 0, len(deps))
+	for dep := range deps {
+		sorted = append(sorted, dep)
+	}
+	slices.SortFunc(sorted, compareInstanceRefs)
+	return sorted
+}
+
+func compareInstanceRefs(a, b communication.InstanceRef) int {
+	if a.Replica != b.Replica {
+		return cmp.Compare(a.Replica, b.Replica)
+	}
+	return cmp.Compare(a.Instance, b.Instance)
+}
@@ -0,0 +1,102 @@
+package paxosImpl
+
+import (
+	"cmp"
+	"paxos/communication"
+	"slices"
+)
+
+// sccSearch holds the state of one run of Tarjan's algorithm over the dependency graph of committed instances.
+type sccSearch struct {
+	next    int                                // Index given to the next instance visited
+	index   map[communication.InstanceRef]int  // Order in which instances were visited
+	lowlink map[communication.InstanceRef]int  // Lowest index reachable from each instance on the stack
+	onStack map[communication.InstanceRef]bool // Instances whose component has not been completed yet
+	stack   []communication.InstanceRef        // Visited instances not yet assigned to a component
+}
+
+// execute executes every committed command whose dependencies are all committed. Commands execute one strongly
+// connected component of the dependency graph at a time, after every component they depend on, and the commands
+// of a component in order of sequence number. Every replica therefore executes conflicting commands in the same
+// order. A command with an uncommitted dependency waits for the Commit of that dependency.
+func (r *EPaxosReplica) execute() {
+	roots := []communication.InstanceRef{}
+	for ref, instance := range r.instances {
+		if instance.status == statusCommitted {
+			roots = append(roots, ref)
+		}
+	}
+	slices.SortFunc(roots, compareInstanceRefs)
+	for _, ref := range roots {
+		if r.instances[ref].status != statusCommitted {
+			continue
+		}
+		search := &sccSearch{
+			index:   make(map[communication.InstanceRef]int),
+			lowlink: make(map[communication.InstanceRef]int),
+			onStack: make(map[communication.InstanceRef]bool),
+		}
+		r.strongConnect(search, ref)
+	}
+}
+
+// strongConnect visits an instance in Tarjan's algorithm and executes each component as soon as it is complete,
+// which is after every component reachable from it. It returns false, leaving the rest of the search unexecuted,
+// when it reaches an instance that is not committed yet.
+func (r *EPaxosReplica) strongConnect(search *sccSearch, ref communication.InstanceRef) bool {
+	instance, exists := r.instances[ref]
+	if !exists || instance.status < statusCommitted {
+		return false
+	}
+	search.index[ref] = search.next
+	search.lowlink[ref] = search.next
+	search.next++
+	search.stack = append(search.stack, ref)
+	search.onStack[ref] = true
+
+	for dep := range instance.deps {
+		if depInstance, exists := r.instances[dep]; exists && depInstance.status == statusExecuted {
+			continue
+		}
+		if _, visited := search.index[dep]; !visited {
+			if !r.strongConnect(search, dep) {
+				return false
+			}
+			search.lowlink[ref] = min(search.lowlink[ref], search.lowlink[dep])
+		} else if search.onStack[dep] {
+			search.lowlink[ref] = min(search.lowlink[ref], search.index[dep])
+		}
+	}
+	if search.lowlink[ref] != search.index[ref] {
+		return true
+	}
+
+	// ref is the root of a component, which consists of the instances above it on the stack
+	start := slices.Index(search.stack, ref)
+	component := slices.Clone(search.stack[start:])
+	search.stack = search.stack[:start]
+	for _, member := range component {
+		search.onStack[member] = false
+	}
+	slices.SortFunc(component, func(a, b communication.InstanceRef) int {
+		if seqA, seqB := r.instances[a].seq, r.instances[b].seq; seqA != seqB {
+			return cmp.Compare(seqA, seqB)
+		}
+		return compareInstanceRefs(a, b)
+	})
+	for _, member := range component {
+		r.executeInstance(member)
+	}
+	return true
+}
+
+// executeInstance executes a single committed command, applying it to the state machine with its position in the
+// execution order as its slot. Commands are numbered in the order this replica executes them, and the log line
+// reports the sequence number and owner of the instance in place of a ballot.
+func (r *EPaxosReplica) executeInstance(ref communication.InstanceRef) {
+	instance := r.instances[ref]
+	instance.status = statusExecuted
+	communication.LogEvent(r.id, "executed", "execute", r.executed, instance.command, communication.Ballot{Round: instance.seq, HostID: ref.Replica})
+	r.applier.Deliver(r.executed, instance.command)
+	r.executed++
+}
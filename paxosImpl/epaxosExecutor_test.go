@@ -0,0 +1,130 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"reflect"
+	"testing"
+)
+
+// commandLog is a state machine that records the commands applied to it, in order.
+type commandLog struct {
+	commands []interface{}
+}
+
+func (c *commandLog) Apply(slot int64, command interface{}) interface{} {
+	c.commands = append(c.commands, command)
+	return command
+}
+
+func (c *commandLog) Snapshot() interface{} {
+	return nil
+}
+
+func (c *commandLog) Restore(state interface{}) error {
+	return nil
+}
+
+// testInstance describes an EPaxos instance of replica 1, named by its command, for the executor tests.
+type testInstance struct {
+	instance int64
+	command  string
+	seq      int64
+	deps     []int64 // Instances of replica 1 the command depends on
+	status   int
+}
+
+func TestEPaxosExecutionOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances []testInstance
+		want      []interface{}
+	}{
+		{
+			name: "dependency chain",
+			instances: []testInstance{
+				{instance: 0, command: "a", seq: 3, deps: []int64{1}, status: statusCommitted},
+				{instance: 1, command: "b", seq: 2, deps: []int64{2}, status: statusCommitted},
+				{instance: 2, command: "c", seq: 1, status: statusCommitted},
+			},
+			want: []interface{}{"c", "b", "a"},
+		},
+		{
+			name: "cycle ordered by sequence number",
+			instances: []testInstance{
+				{instance: 0, command: "a", seq: 2, deps: []int64{1}, status: statusCommitted},
+				{instance: 1, command: "b", seq: 1, deps: []int64{0}, status: statusCommitted},
+			},
+			want: []interface{}{"b", "a"},
+		},
+		{
+			name: "cycle with equal sequence numbers ordered by instance",
+			instances: []testInstance{
+				{instance: 0, command: "a", seq: 1, deps: []int64{2}, status: statusCommitted},
+				{instance: 1, command: "b", seq: 1, deps: []int64{0}, status: statusCommitted},
+				{instance: 2, command: "c", seq: 1, deps: []int64{1}, status: statusCommitted},
+			},
+			want: []interface{}{"a", "b", "c"},
+		},
+		{
+			name: "component after the cycle it depends on",
+			instances: []testInstance{
+				{instance: 0, command: "d", seq: 1, deps: []int64{1}, status: statusCommitted},
+				{instance: 1, command: "a", seq: 3, deps: []int64{2}, status: statusCommitted},
+				{instance: 2, command: "b", seq: 2, deps: []int64{1}, status: statusCommitted},
+			},
+			want: []interface{}{"b", "a", "d"},
+		},
+		{
+			name: "uncommitted dependency blocks its dependents only",
+			instances: []testInstance{
+				{instance: 0, command: "a", seq: 2, deps: []int64{1}, status: statusCommitted},
+				{instance: 1, command: "b", seq: 1, status: statusPreAccepted},
+				{instance: 2, command: "c", seq: 1, status: statusCommitted},
+			},
+			want: []interface{}{"c"},
+		},
+		{
+			name: "missing dependency blocks its dependents",
+			instances: []testInstance{
+				{instance: 0, command: "a", seq: 2, deps: []int64{5}, status: statusCommitted},
+			},
+			want: nil,
+		},
+		{
+			name: "executed dependency is skipped",
+			instances: []testInstance{
+				{instance: 0, command: "a", seq: 2, deps: []int64{1}, status: statusCommitted},
+				{instance: 1, command: "b", seq: 1, status: statusExecuted},
+			},
+			want: []interface{}{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stateMachine := &commandLog{}
+			r := NewEPaxosReplica(1, 1, []int64{1, 2, 3}, NewApplier(1, stateMachine), RetryPolicy{}, nil, nil, nil)
+			for _, instance := range tt.instances {
+				deps := make(map[communication.InstanceRef]bool)
+				for _, dep := range instance.deps {
+					deps[communication.InstanceRef{Replica: 1, Instance: dep}] = true
+				}
+				r.instances[communication.InstanceRef{Replica: 1, Instance: instance.instance}] = &epaxosInstance{
+					command: instance.command,
+					seq:     instance.seq,
+					deps:    deps,
+					status:  instance.status,
+				}
+			}
+
+			r.execute()
+			if !reflect.DeepEqual(stateMachine.commands, tt.want) {
+				t.Errorf("executed %v, want %v", stateMachine.commands, tt.want)
+			}
+			// Executing again finds nothing new
+			r.execute()
+			if !reflect.DeepEqual(stateMachine.commands, tt.want) {
+				t.Errorf("executed %v after a second run, want %v", stateMachine.commands, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"paxos/communication"
+)
+
+// handleAnyMessage opens a fast round. Until a higher ballot is promised, client values are accepted under the
+// message's ballot in the free slots at or above the message slot.
+func (a *Acceptor) handleAnyMessage(message communication.Message) {
+	slot := message.Payload.Slot
+	minProposal := a.stateManager.GetMinProposalFrom(slot)
+	if !message.Payload.Ballot.AtLeast(minProposal) {
+		err := a.tcpCommunicator.SendAcceptNackMessage(message.Header.SenderID, message.Header.ProposerID, slot, minProposal)
+		if err != nil {
+			fmt.Printf("Failed to send accept_nack to peer %v: %v\n", message.Header.SenderID, err)
+		}
+		return
+	}
+	a.anyBallot = message.Payload.Ballot
+	a.anyFrom = slot
+}
+
+// handleClientValue accepts a value sent directly by a client in the lowest slot of the open fast round that has
+// not accepted a value under the fast ballot yet. Values arriving while no fast round is open are dropped; the
+// client falls back to a classic round when its fast round times out.
+func (a *Acceptor) handleClientValue(message communication.Message) {
+	if a.anyBallot.IsZero() {
+		fmt.Printf("Ignoring client value %v, no fast round is open\n", message.Payload.Value)
+		return
+	}
+	slot := a.anyFrom
+	for a.stateManager.GetAcceptedProposal(slot) == a.anyBallot {
+		slot++
+	}
+	// A higher ballot promised since the fast round was opened closes it
+	if !a.anyBallot.AtLeast(a.stateManager.GetMinProposal(slot)) {
+		a.anyBallot = communication.Ballot{}
+		fmt.Printf("Ignoring client value %v, the fast round was superseded\n", message.Payload.Value)
+		return
+	}
+	a.acceptValue(message, slot, a.anyBallot, message.Payload.Value, true)
+}
+
+// proposeFast opens a fast round from the current slot on. The leader sends an "any" Accept, which lets
+// acceptors accept the values clients send them directly, under its ballot, in this slot and every later one. The
+// round stays open while the leader waits for client values, and each slot is chosen as soon as a fast quorum
+// accepted the same value in it. The caller must hold p.mu.
+func (p *Proposer) proposeFast() {
+	ballot := p.state.Ballot()
+	if p.anyBallot != ballot {
+		for _, acceptorID := range p.acceptors() {
+			err := p.tcpCommunicator.SendAnyMessage(acceptorID, p.proposerID, p.slot, ballot)
+			if err != nil {
+				fmt.Printf("Failed to send accept to peer %v: %v\n", acceptorID, err)
+			}
+		}
+		p.anyBallot = ballot
+		p.fastVotes = make(map[int64]map[int64]interface{})
+	}
+	// Whatever round led here is over
+	if p.phase != phaseFast {
+		p.phase = phaseIdle
+	}
+	p.awaitFastVotes()
+}
+
+// awaitFastVotes waits for client values in the open fast round. The leader stays idle while no client sends
+// anything, and the phase timeout runs while some slot has votes but no value has been chosen in it yet. The caller
+// must hold p.mu.
+func (p *Proposer) awaitFastVotes() {
+	if p.phase != phaseIdle && p.phase != phaseFast {
+		return
+	}
+	if len(p.fastVotes) == 0 {
+		p.stopTimer()
+		p.phase = phaseIdle
+		return
+	}
+	if p.phase == phaseIdle {
+		p.phase = phaseFast
+		p.resetTimer(p.retryPolicy.PhaseTimeout)
+	}
+}
+
+// handleFastVote counts an Accepted message of the open fast round. Acceptors place client values in their lowest
+// free slot, so votes may arrive for any slot from the one the round was opened at, and a value is chosen in a slot
+// once a fast quorum accepted it there. When concurrent client values collide in a slot so that none of them can
+// reach a fast quorum any more, the slots from the lowest undecided one on are decided by a classic round. Votes
+// arriving while a classic round is being started are left to its Phase 1. The caller must hold p.mu.
+func (p *Proposer) handleFastVote(message communication.Message) {
+	slot := message.Payload.Slot
+	if _, done := p.chosen[slot]; done || slot < p.slot || (p.phase != phaseIdle && p.phase != phaseFast) {
+		return
+	}
+	votes, ok := p.fastVotes[slot]
+	if !ok {
+		votes = make(map[int64]interface{})
+		p.fastVotes[slot] = votes
+	}
+	votes[message.Header.SenderID] = message.Payload.Value
+
+	counts := make(map[interface{}]int)
+	best := 0
+	for _, value := range votes {
+		key := communication.ValueKey(value)
+		counts[key]++
+		if counts[key] >= p.fastQuorumSize() {
+			delete(p.fastVotes, slot)
+			p.choose(slot, value, fastAcceptors(votes, value))
+			p.awaitFastVotes()
+			return
+		}
+		best = max(best, counts[key])
+	}
+	if best+len(p.acceptors())-len(votes) < p.fastQuorumSize() {
+		communication.LogEvent(p.id, "collision", "fast", slot, nil, message.Payload.Ballot)
+		p.prepare()
+		return
+	}
+	p.awaitFastVotes()
+}
+
+// fastAcceptors returns the acceptors whose vote in a slot of the fast round is the given value.
+func fastAcceptors(votes map[int64]interface{}, value interface{}) map[int64]bool {
+	accepted := make(map[int64]bool)
+	for acceptorID, vote := range votes {
+		if communication.ValueKey(vote) == communication.ValueKey(value) {
+			accepted[acceptorID] = true
+		}
+	}
+	return accepted
+}
@@ -0,0 +1,157 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"maps"
+	"paxos/communication"
+	"slices"
+	"time"
+)
+
+// clientVote names the slot and ballot under which an acceptor accepted a command of a FastClient.
+type clientVote struct {
+	slot   int64
+	ballot communication.Ballot
+	fast   bool
+}
+
+// fastSubmission is a command of a FastClient that has not been seen chosen yet.
+type fastSubmission struct {
+	command communication.Command
+	sentAt  time.Time                     // When the command was sent to the acceptors
+	votes   map[clientVote]map[int64]bool // Acceptors that accepted the command in each slot under each ballot
+}
+
+// FastClient submits client values in Fast Paxos mode. Each value becomes a command that is sent straight to the
+// acceptors under the zero ballot, so that the acceptors accept it in the fast round the leader opened and it is
+// chosen in one round trip. The client watches the acceptors accept its commands. A command not seen chosen within
+// the timeout, because no fast round was open, the acceptors collided or some of them did not answer, is forwarded
+// to the leader, which proposes it in a classic round. The leader drops a forwarded command that its Phase 1 finds
+// accepted somewhere, but one chosen in a slot the acceptors already compacted is chosen again: delivery is
+// at-least-once.
+type FastClient struct {
+	id                 int64                          // Host ID of the node running the client, the origin of its commands
+	instance           int64                          // Proposer number of the instance the client submits to
+	membership         *Membership                    // The acceptor set of each slot
+	auxiliaries        []int64                        // Auxiliary acceptors, whose votes are counted in every slot
+	proposers          []int64                        // Host IDs running proposers of the instance, forwarded to while no leader is known
+	quorumPolicy       QuorumPolicy                   // Quorum sizes, applied to the acceptor set of each slot
+	timeout            time.Duration                  // How long a command may take before it is forwarded to the leader
+	seq                int64                          // Sequence number of the latest command
+	submissions        map[int64]*fastSubmission      // Commands not seen chosen yet, by sequence number
+	leader             int64                          // Host ID owning the highest ballot seen, 0 when none
+	leaderBallot       communication.Ballot           // The highest ballot seen in an Accepted message
+	tcpCommunicator    *communication.TcpCommunicator // Communicator to send and receive messages
+	sendProposalCh     chan interface{}               // Channel to receive client values
+	acceptedMessagesCh chan communication.Message     // Channel to receive Accepted notifications for the instance
+}
+
+// NewFastClient initializes a client. Sequence numbers start from the clock, so that the commands of a restarted
+// client are not mistaken for those it submitted before.
+func NewFastClient(id int64, instance int64, membership *Membership, auxiliaries []int64, proposers []int64, quorumPolicy QuorumPolicy,
+	timeout time.Duration, tcpCommunicator *communication.TcpCommunicator, sendProposalCh chan interface{},
+	acceptedMessagesCh chan communication.Message) *FastClient {
+	return &FastClient{
+		id:                 id,
+		instance:           instance,
+		membership:         membership,
+		auxiliaries:        auxiliaries,
+		proposers:          proposers,
+		quorumPolicy:       quorumPolicy,
+		timeout:            timeout,
+		seq:                time.Now().UnixNano(),
+		submissions:        make(map[int64]*fastSubmission),
+		tcpCommunicator:    tcpCommunicator,
+		sendProposalCh:     sendProposalCh,
+		acceptedMessagesCh: acceptedMessagesCh,
+	}
+}
+
+func (c *FastClient) Listen() {
+	ticker := time.NewTicker(c.timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case value := <-c.sendProposalCh:
+			c.submit(value)
+		case message := <-c.acceptedMessagesCh:
+			c.handleAcceptedMessage(message)
+		case <-ticker.C:
+			c.forwardExpired()
+		}
+	}
+}
+
+// submit sends a value to the current acceptors as a new command under the zero ballot.
+func (c *FastClient) submit(value interface{}) {
+	c.seq++
+	command := communication.Command{Origin: c.id, Seq: c.seq, Value: value}
+	c.submissions[c.seq] = &fastSubmission{command: command, sentAt: time.Now(), votes: make(map[clientVote]map[int64]bool)}
+	for _, acceptorID := range c.membership.Latest() {
+		err := c.tcpCommunicator.SendAcceptMessage(acceptorID, c.instance, 0, communication.Ballot{}, command)
+		if err != nil {
+			fmt.Printf("Failed to send accept to peer %v: %v\n", acceptorID, err)
+		}
+	}
+}
+
+// handleAcceptedMessage follows the leader through the ballots acceptors report, and counts the votes for the
+// client's own commands. A command is chosen once a quorum accepted it in the same slot under the same ballot: a fast
+// quorum when acceptors took it from the client in a fast round, a classic one when a leader proposed it.
+func (c *FastClient) handleAcceptedMessage(message communication.Message) {
+	ballot := message.Payload.Ballot
+	if ballot.GreaterThan(c.leaderBallot) {
+		c.leaderBallot = ballot
+		c.leader = ballot.HostID
+	}
+	slot, sender := message.Payload.Slot, message.Header.SenderID
+	acceptors := slices.Concat(c.membership.Acceptors(slot), c.auxiliaries)
+	if !slices.Contains(acceptors, sender) {
+		return
+	}
+	for _, command := range communication.Commands(message.Payload.Value) {
+		own, ok := command.(communication.Command)
+		if !ok || own.Origin != c.id {
+			continue
+		}
+		submission, pending := c.submissions[own.Seq]
+		if !pending {
+			continue
+		}
+		accepted := clientVote{slot: slot, ballot: ballot, fast: message.Payload.Fast}
+		if submission.votes[accepted] == nil {
+			submission.votes[accepted] = make(map[int64]bool)
+		}
+		submission.votes[accepted][sender] = true
+		quorumSize := c.quorumPolicy.phase2Size(len(acceptors))
+		if accepted.fast {
+			quorumSize = c.quorumPolicy.fastSize(len(acceptors))
+		}
+		if len(submission.votes[accepted]) >= quorumSize {
+			delete(c.submissions, own.Seq)
+		}
+	}
+}
+
+// forwardExpired forwards the commands that were not seen chosen within the timeout, oldest first, to the leader,
+// or to a proposer of the instance while no leader is known. A command that cannot be forwarded is tried again on
+// the next tick.
+func (c *FastClient) forwardExpired() {
+	target := c.leader
+	if target == 0 && len(c.proposers) > 0 {
+		target = c.proposers[0]
+	}
+	now := time.Now()
+	for _, seq := range slices.Sorted(maps.Keys(c.submissions)) {
+		submission := c.submissions[seq]
+		if now.Sub(submission.sentAt) < c.timeout {
+			continue
+		}
+		err := c.tcpCommunicator.SendForwardMessage(target, c.instance, submission.command)
+		if err != nil {
+			fmt.Printf("Failed to forward to leader %v: %v\n", target, err)
+			return
+		}
+		delete(c.submissions, seq)
+	}
+}
@@ -0,0 +1,156 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"math/rand"
+	"paxos/communication"
+	"time"
+)
+
+// LeaderPolicy controls how the distinguished leader announces itself and how quickly followers replace it.
+type LeaderPolicy struct {
+	HeartbeatInterval time.Duration // How often the leader sends heartbeats to the other proposers
+	ElectionTimeout   time.Duration // How long followers wait without a heartbeat before suspecting the leader
+}
+
+// electionDeadline returns when a follower that just heard from the leader should suspect it. The
+// timeout is randomized so that followers do not all start Phase 1 at the same time.
+func (l LeaderPolicy) electionDeadline(now time.Time) time.Time {
+	jitter := time.Duration(0)
+	if l.ElectionTimeout > 1 {
+		jitter = time.Duration(rand.Int63n(int64(l.ElectionTimeout / 2)))
+	}
+	return now.Add(l.ElectionTimeout + jitter)
+}
+
+// hasLiveLeader reports whether another proposer is known to lead and has not been suspected yet. The caller must hold p.mu.
+func (p *Proposer) hasLiveLeader() bool {
+	return !p.isLeader && p.leaderHost != 0 && time.Now().Before(p.leaderDeadline)
+}
+
+// becomeLeader is called once a majority promised the current ballot. The caller must hold p.mu.
+func (p *Proposer) becomeLeader() {
+	if !p.isLeader {
+		communication.LogEvent(p.id, "elected", "leader", p.slot, nil, p.state.Ballot())
+	}
+	p.isLeader = true
+	p.leaderHost = p.id
+	p.leaderBallot = p.state.Ballot()
+	p.sendHeartbeats()
+	p.requestLease()
+}
+
+// stepDown gives up leadership after a higher ballot has been observed. The slots in flight cannot be chosen under
+// our ballot anymore, so our own values in them go back to the queue, to be handed to the new leader or proposed
+// again. The caller must hold p.mu.
+func (p *Proposer) stepDown() {
+	if p.isLeader {
+		communication.LogEvent(p.id, "stepped_down", "leader", p.slot, nil, p.state.MaxSeenBallot())
+	}
+	p.abandonPipeline()
+	p.dropLease()
+	p.failReads(fmt.Errorf("proposer %v stepped down", p.proposerID))
+	p.isLeader = false
+}
+
+// observeBallot records a ballot reported by another node and steps down if it outranks ours. The caller must hold p.mu.
+func (p *Proposer) observeBallot(ballot communication.Ballot) {
+	if p.state.ObserveBallot(ballot) && p.isLeader {
+		p.stepDown()
+	}
+}
+
+// sendHeartbeats tells every other proposer host of the instance that this proposer leads. The caller must hold p.mu.
+func (p *Proposer) sendHeartbeats() {
+	ballot := p.state.Ballot()
+	for _, peerID := range p.peers {
+		if peerID == p.id {
+			continue
+		}
+		// A missed heartbeat is harmless, so unreachable peers are skipped silently
+		_ = p.tcpCommunicator.SendHeartbeatMessage(peerID, p.proposerID, p.slot, ballot)
+	}
+}
+
+// handleHeartbeatTick sends heartbeats while leading, and takes over by running Phase 1 once the known leader is suspected.
+func (p *Proposer) handleHeartbeatTick() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isLeader {
+		p.sendHeartbeats()
+		p.requestLease()
+		p.retryConfirmation()
+		p.replicateToMain()
+		return
+	}
+	if p.leaderHost == 0 {
+		// Acceptors only take client values in a fast round a leader opened, so in Fast Paxos mode a proposer that
+		// hears of no leader takes the lead even with nothing queued
+		if p.fastMode && p.phase == phaseIdle && !time.Now().Before(p.leaderDeadline) {
+			p.leaderDeadline = p.leaderPolicy.electionDeadline(time.Now())
+			p.attempts = 0
+			p.prepare()
+		}
+		return
+	}
+	if time.Now().Before(p.leaderDeadline) {
+		return
+	}
+	communication.LogEvent(p.id, "suspected", "leader", p.slot, nil, p.leaderBallot)
+	p.leaderHost = 0
+	if p.phase == phaseIdle {
+		p.attempts = 0
+		p.prepare()
+	}
+}
+
+// handleHeartbeatMessage follows the proposer with the highest ballot that announces itself as leader.
+func (p *Proposer) handleHeartbeatMessage(message communication.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ballot := message.Payload.Ballot
+	p.observeBallot(ballot)
+	if p.isLeader || ballot.Compare(p.leaderBallot) < 0 {
+		return
+	}
+	p.leaderHost = message.Header.SenderID
+	p.leaderBallot = ballot
+	p.leaderDeadline = p.leaderPolicy.electionDeadline(time.Now())
+	// Slots below the leader's are being filled by it, so a takeover starts from there
+	if p.phase == phaseIdle && message.Payload.Slot > p.slot {
+		p.slot = message.Payload.Slot
+	}
+	if ballot.AtLeast(p.state.Ballot()) {
+		p.handOverPending()
+	}
+}
+
+// handOverPending forwards the values a follower queued, before it knew the leader or while it led itself, and gives
+// up its own round so that it stops competing with the leader. Values a former leader had in flight may already
+// have been accepted, and the new leader's Phase 1 recovers those too, so such a command may be chosen twice: it is
+// retried at least once rather than lost. Values that cannot be forwarded stay queued, and the round goes on. The
+// caller must hold p.mu.
+func (p *Proposer) handOverPending() {
+	if p.phase == phaseIdle {
+		return
+	}
+	for len(p.pending) > 0 {
+		if err := p.tcpCommunicator.SendForwardMessage(p.leaderHost, p.proposerID, p.pending[0]); err != nil {
+			fmt.Printf("Failed to forward to leader %v, proposing locally: %v\n", p.leaderHost, err)
+			return
+		}
+		p.pending = p.pending[1:]
+	}
+	p.stopTimer()
+	p.phase = phaseIdle
+}
+
+// handleForwardMessage proposes a value forwarded by another proposer. Forwarded values are never forwarded
+// again, so a proposer with a stale view of the leader proposes the value itself.
+func (p *Proposer) handleForwardMessage(message communication.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enqueue(message.Payload.Value)
+}
@@ -0,0 +1,134 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// heartbeatFrom returns the heartbeat of a leader on another host.
+func heartbeatFrom(hostID int64, slot int64, ballot communication.Ballot) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{SenderID: hostID, ProposerID: 1, MessageType: communication.HEARTBEAT},
+		Payload: communication.PaxosMessage{Slot: slot, Ballot: ballot},
+	}
+}
+
+func TestHeartbeatStepsLeaderDown(t *testing.T) {
+	tests := []struct {
+		name        string
+		queued      []interface{}
+		reported    map[int64][]communication.LogEntry
+		heartbeat   communication.Ballot
+		wantLeader  bool
+		wantPending []interface{} // Client values left queued, as forwarding to the new leader fails
+	}{
+		{
+			name:        "own values in flight go back to the queue",
+			queued:      []interface{}{"a", "b"},
+			heartbeat:   communication.Ballot{Round: 5, HostID: 2},
+			wantPending: []interface{}{"a", "b"},
+		},
+		{
+			name:        "recovered values stay with the acceptors",
+			queued:      []interface{}{"a"},
+			reported:    map[int64][]communication.LogEntry{2: {{Slot: 0, Ballot: communication.Ballot{Round: 1, HostID: 3}, Value: "x"}}},
+			heartbeat:   communication.Ballot{Round: 5, HostID: 2},
+			wantPending: []interface{}{"a"},
+		},
+		{
+			name:        "lower ballot",
+			queued:      []interface{}{"a"},
+			heartbeat:   communication.Ballot{Round: 1, HostID: 2},
+			wantLeader:  true,
+			wantPending: []interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProposer(ProposerConfig{Window: 4, Peers: []int64{1, 2}})
+			p.state.ObserveBallot(communication.Ballot{Round: 1, HostID: 3})
+			for _, value := range tt.queued {
+				p.sendProposal(value)
+			}
+			elect(p, tt.reported)
+			if !p.isLeader || len(p.inflight) == 0 {
+				t.Fatalf("leader %v with %v slots in flight after Phase 1", p.isLeader, len(p.inflight))
+			}
+
+			p.handleHeartbeatMessage(heartbeatFrom(2, 0, tt.heartbeat))
+			if p.isLeader != tt.wantLeader {
+				t.Errorf("leader %v after the heartbeat, want %v", p.isLeader, tt.wantLeader)
+			}
+			if tt.wantLeader {
+				return
+			}
+			if len(p.inflight) != 0 || p.leaderHost != 2 {
+				t.Errorf("%v slots in flight following host %v, want none following host 2", len(p.inflight), p.leaderHost)
+			}
+			pending := []interface{}{}
+			for _, command := range p.pending {
+				pending = append(pending, communication.CommandValue(command))
+			}
+			if !reflect.DeepEqual(pending, tt.wantPending) {
+				t.Errorf("queued %v, want %v", pending, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestFollowerTracksLeader(t *testing.T) {
+	leader := communication.Ballot{Round: 3, HostID: 2}
+	tests := []struct {
+		name       string
+		heartbeats []communication.Message
+		deadline   time.Duration // Time left before the leader is suspected when the heartbeat timer ticks
+		wantLeader int64
+		wantPhase  int
+		wantSlot   int64
+	}{
+		{
+			name:       "follows the leader and its slot",
+			heartbeats: []communication.Message{heartbeatFrom(2, 7, leader)},
+			deadline:   time.Hour,
+			wantLeader: 2,
+			wantPhase:  phaseIdle,
+			wantSlot:   7,
+		},
+		{
+			name:       "ignores a stale leader",
+			heartbeats: []communication.Message{heartbeatFrom(2, 7, leader), heartbeatFrom(3, 9, communication.Ballot{Round: 2, HostID: 3})},
+			deadline:   time.Hour,
+			wantLeader: 2,
+			wantPhase:  phaseIdle,
+			wantSlot:   7,
+		},
+		{
+			name:       "takes over from a silent leader",
+			heartbeats: []communication.Message{heartbeatFrom(2, 7, leader)},
+			deadline:   -time.Second,
+			wantLeader: 0,
+			wantPhase:  phasePrepare,
+			wantSlot:   7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProposer(ProposerConfig{Peers: []int64{1, 2, 3}})
+			for _, heartbeat := range tt.heartbeats {
+				p.handleHeartbeatMessage(heartbeat)
+			}
+			p.leaderDeadline = time.Now().Add(tt.deadline)
+			p.handleHeartbeatTick()
+
+			if p.leaderHost != tt.wantLeader || p.phase != tt.wantPhase || p.slot != tt.wantSlot {
+				t.Errorf("following host %v in phase %v at slot %v, want host %v in phase %v at slot %v",
+					p.leaderHost, p.phase, p.slot, tt.wantLeader, tt.wantPhase, tt.wantSlot)
+			}
+			if tt.wantPhase == phasePrepare && !p.state.Ballot().GreaterThan(leader) {
+				t.Errorf("took over with ballot %v, not above the leader's %v", p.state.Ballot(), leader)
+			}
+		})
+	}
+}
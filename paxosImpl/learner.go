@@ -0,0 +1,244 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"paxos/communication"
+	"slices"
+	"sync"
+	"time"
+)
+
+// vote is a value accepted under a ballot, with the value given by its communication.ValueKey. A fast ballot may
+// carry several values in the same slot.
+type vote struct {
+	ballot communication.Ballot
+	key    interface{}
+	fast   bool
+}
+
+// slotVotes tracks the Accepted notifications received for a single slot.
+type slotVotes struct {
+	votes map[vote]map[int64]bool // Acceptors that accepted each value under each ballot
+}
+
+// Learner listens for Accepted notifications from acceptors and detects when a value has been chosen for each slot.
+// Chosen values are delivered in slot order to the applier of the node, which applies them to the state machine of
+// the application. Every snapshotInterval slots the state of the state machine is saved in a snapshot, and the
+// learner and the acceptors drop what they kept for the slots it includes. A learner that misses slots asks the
+// acceptors for them.
+type Learner struct {
+	id                 int64                          // Host ID of the node running the Learner
+	instance           int64                          // Proposer number of the instance the Learner follows
+	membership         *Membership                    // The acceptor set of each slot, whose votes are counted
+	auxiliaries        []int64                        // Auxiliary acceptors, whose votes are counted in every slot
+	quorumPolicy       QuorumPolicy                   // Quorum sizes, applied to the acceptor set of each slot
+	pending            map[int64]*slotVotes           // Votes for slots that have not been chosen yet
+	chosen             map[int64]interface{}          // The chosen value of each decided slot above the last snapshot
+	next               int64                          // The lowest slot not delivered yet
+	applier            *Applier                       // Applies the chosen commands to the state machine of the node
+	snapshotInterval   int64                          // Slots applied between two snapshots, 0 disables snapshots
+	snapshots          *SnapshotStore                 // Durable copy of the latest snapshot, nil keeps none
+	highest            int64                          // The highest slot an acceptor reported a vote for, -1 when none
+	probed             bool                           // Whether the learner asked the acceptors how far the log goes since it started
+	progressMark       int64                          // The lowest slot not applied at the previous catch-up tick
+	requestedTo        int64                          // End of the range asked for in the latest catch-up request, exclusive, 0 once applied
+	reportedEnd        int64                          // The highest slot an acceptor reported in a catch-up reply, -1 when none
+	compactedAt        map[int64]int64                // Slot below which each acceptor reported in a catch-up reply that it discarded its state
+	catchUpInterval    time.Duration                  // How often the learner checks whether it fell behind
+	tcpCommunicator    *communication.TcpCommunicator // Communicator to hand snapshots to the acceptors and catch up
+	acceptedMessagesCh chan communication.Message     // Channel to receive Accepted notifications, catch-up replies and snapshots
+	mu                 sync.RWMutex                   // Mutex for thread-safe access to the chosen values
+}
+
+// NewLearner initializes a new Learner instance. A Learner that saved a snapshot before it restarted restores the state machine of the applier from it, resumes after the last slot it includes,
+// and catches up on later slots from the acceptors.
+func NewLearner(id int64, instance int64, membership *Membership, auxiliaries []int64, quorumPolicy QuorumPolicy,
+	applier *Applier, snapshotInterval int64, snapshots *SnapshotStore, catchUpInterval time.Duration, tcpCommunicator *communication.TcpCommunicator,
+	acceptedMessagesCh chan communication.Message) (*Learner, error) {
+	l := &Learner{
+		id:                 id,
+		instance:           instance,
+		membership:         membership,
+		auxiliaries:        auxiliaries,
+		quorumPolicy:       quorumPolicy,
+		applier:            applier,
+		pending:            make(map[int64]*slotVotes),
+		chosen:             make(map[int64]interface{}),
+		snapshotInterval:   max(snapshotInterval, 0),
+		snapshots:          snapshots,
+		highest:            -1,
+		reportedEnd:        -1,
+		compactedAt:        make(map[int64]int64),
+		catchUpInterval:    catchUpInterval,
+		tcpCommunicator:    tcpCommunicator,
+		acceptedMessagesCh: acceptedMessagesCh,
+	}
+	if snapshots == nil {
+		return l, nil
+	}
+	snapshot, found, err := snapshots.Load()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return l, nil
+	}
+	if err := l.restore(snapshot); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Learner) Listen() {
+	ticker := time.NewTicker(l.catchUpInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case message := <-l.acceptedMessagesCh:
+			switch message.Header.MessageType {
+			case communication.CATCHUP_REPLY:
+				l.handleCatchUpReplyMessage(message)
+			case communication.SNAPSHOT:
+				l.handleSnapshotMessage(message)
+			default:
+				l.handleAcceptedMessage(message)
+			}
+		case <-ticker.C:
+			l.handleCatchUpTick()
+		}
+	}
+}
+
+// handleAcceptedMessage counts an acceptor's vote.
+func (l *Learner) handleAcceptedMessage(message communication.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.highest = max(l.highest, message.Payload.Slot)
+	l.countVote(message.Payload.Slot, message.Header.SenderID, message.Payload.Ballot, message.Payload.Value, message.Payload.Fast)
+}
+
+// countVote counts the vote of an acceptor for a value under a ballot, and emits the chosen event for a slot once a
+// quorum accepted the same value under the same ballot. Values accepted from clients in a fast round need a fast
+// quorum, values proposed by a leader a classic one. The caller must hold l.mu.
+func (l *Learner) countVote(slot int64, sender int64, ballot communication.Ballot, value interface{}, fast bool) {
+	acceptors := slices.Concat(l.membership.Acceptors(slot), l.auxiliaries)
+	if _, decided := l.chosen[slot]; decided || slot < l.next || !slices.Contains(acceptors, sender) {
+		return
+	}
+	state, exists := l.pending[slot]
+	if !exists {
+		state = &slotVotes{
+			votes: make(map[vote]map[int64]bool),
+		}
+		l.pending[slot] = state
+	}
+	accepted := vote{ballot: ballot, key: communication.ValueKey(value), fast: fast}
+	if state.votes[accepted] == nil {
+		state.votes[accepted] = make(map[int64]bool)
+	}
+	state.votes[accepted][sender] = true
+
+	quorumSize := l.quorumPolicy.phase2Size(len(acceptors))
+	if fast {
+		quorumSize = l.quorumPolicy.fastSize(len(acceptors))
+	}
+	if len(state.votes[accepted]) < quorumSize {
+		return
+	}
+	l.chosen[slot] = value
+	delete(l.pending, slot)
+	for _, command := range communication.Commands(value) {
+		communication.LogEvent(l.id, "learned", "chose", slot, command, accepted.ballot)
+	}
+	l.membership.Apply(slot, value)
+	l.apply()
+}
+
+// apply delivers the chosen values to the applier in slot order, up to the first slot not learned yet. It takes a
+// snapshot every snapshotInterval slots. Once the range of the latest catch-up request is applied, the next range
+// is asked for right away if the acceptors reported later slots. The caller must hold l.mu.
+func (l *Learner) apply() {
+	for {
+		value, ok := l.chosen[l.next]
+		if !ok {
+			if l.requestedTo > 0 && l.next >= l.requestedTo {
+				l.requestedTo = 0
+				if l.next <= l.reportedEnd {
+					l.requestCatchUp()
+				}
+			}
+			return
+		}
+		l.applier.Deliver(l.next, value)
+		l.next++
+		if l.snapshotInterval > 0 && l.next%l.snapshotInterval == 0 {
+			l.takeSnapshot()
+		}
+	}
+}
+
+// takeSnapshot saves the state of the state machine after the last applied slot and drops the chosen values and
+// votes of the slots it includes. The proposer of the host may have applied slots the learner did not learn yet,
+// and those count as learned. The acceptors of the instance are then handed the snapshot, so they can discard their
+// state of those slots too. The caller must hold l.mu.
+func (l *Learner) takeSnapshot() {
+	lastSlot, state := l.applier.State()
+	snapshot := Snapshot{LastSlot: lastSlot, State: state, Reconfigurations: l.membership.Reconfigurations(lastSlot)}
+	// Nothing is dropped unless the snapshot is durable
+	if l.snapshots != nil {
+		if err := l.snapshots.Save(snapshot); err != nil {
+			fmt.Printf("Failed to save snapshot of slot %v: %v\n", snapshot.LastSlot, err)
+			return
+		}
+	}
+	l.next = max(l.next, snapshot.LastSlot+1)
+	l.truncate(snapshot.LastSlot)
+	communication.LogEvent(l.id, "snapshot", "compact", snapshot.LastSlot, nil, communication.Ballot{})
+	for _, acceptorID := range slices.Concat(l.membership.Latest(), l.auxiliaries) {
+		err := l.tcpCommunicator.SendCompactMessage(acceptorID, l.instance, snapshot.LastSlot, snapshot.State, snapshot.Reconfigurations)
+		if err != nil {
+			fmt.Printf("Failed to send compact to peer %v: %v\n", acceptorID, err)
+		}
+	}
+}
+
+// restore resumes from a snapshot, when the learner starts or once it caught up through one: the applier restores
+// the state machine from the snapshot's state unless it is already past it, the slots it includes count as
+// applied, and the reconfigurations chosen in them are applied to the membership again. Nothing changes if the
+// state machine cannot restore the state.
+func (l *Learner) restore(snapshot Snapshot) error {
+	if err := l.applier.Restore(snapshot); err != nil {
+		return err
+	}
+	for _, entry := range snapshot.Reconfigurations {
+		l.membership.Apply(entry.Slot, entry.Value)
+	}
+	l.next = snapshot.LastSlot + 1
+	l.truncate(snapshot.LastSlot)
+	communication.LogEvent(l.id, "restored", "compact", snapshot.LastSlot, nil, communication.Ballot{})
+	return nil
+}
+
+// truncate drops the chosen values and votes of every slot up to lastSlot. The caller must hold l.mu.
+func (l *Learner) truncate(lastSlot int64) {
+	for slot := range l.chosen {
+		if slot <= lastSlot {
+			delete(l.chosen, slot)
+		}
+	}
+	for slot := range l.pending {
+		if slot <= lastSlot {
+			delete(l.pending, slot)
+		}
+	}
+}
+
+// GetChosenValue returns the chosen value of a slot and whether one has been learned yet. Values of slots included
+// in a snapshot are no longer known.
+func (l *Learner) GetChosenValue(slot int64) (interface{}, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	value, ok := l.chosen[slot]
+	return value, ok
+}
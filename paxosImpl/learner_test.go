@@ -0,0 +1,116 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestLearner returns the learner of host 1 in an instance whose acceptors are hosts 1, 2 and 3, together with
+// the state machine its applier feeds. It is connected to nobody, and keeps no snapshots.
+func newTestLearner() (*Learner, *commandLog) {
+	membership := NewMembership(1, []int64{1, 2, 3}, 1, QuorumPolicy{}, 0, nil)
+	stateMachine := &commandLog{}
+	l, _ := NewLearner(1, 1, membership, nil, QuorumPolicy{}, NewApplier(1, stateMachine), 0, nil, time.Hour,
+		communication.NewTcpCommunicator(), nil)
+	return l, stateMachine
+}
+
+// acceptedVote returns the Accepted notification of an acceptor for a value in a slot under a ballot.
+func acceptedVote(acceptorID int64, slot int64, ballot communication.Ballot, value interface{}, fast bool) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{SenderID: acceptorID, ProposerID: 1, MessageType: communication.ACCEPTED},
+		Payload: communication.PaxosMessage{Slot: slot, Ballot: ballot, Value: value, Fast: fast},
+	}
+}
+
+func TestLearnerQuorumOfFastAndClassicVotes(t *testing.T) {
+	ballot := communication.Ballot{Round: 1, HostID: 1}
+	tests := []struct {
+		name   string
+		votes  []communication.Message
+		chosen []interface{}
+	}{
+		{
+			name:   "classic value accepted by a majority",
+			votes:  []communication.Message{acceptedVote(1, 0, ballot, "a", false), acceptedVote(2, 0, ballot, "a", false)},
+			chosen: []interface{}{"a"},
+		},
+		{
+			name:  "fast value accepted by a majority",
+			votes: []communication.Message{acceptedVote(1, 0, ballot, "a", true), acceptedVote(2, 0, ballot, "a", true)},
+		},
+		{
+			name: "fast value accepted by a fast quorum",
+			votes: []communication.Message{
+				acceptedVote(1, 0, ballot, "a", true), acceptedVote(2, 0, ballot, "a", true), acceptedVote(3, 0, ballot, "a", true),
+			},
+			chosen: []interface{}{"a"},
+		},
+		{
+			name:  "fast and classic votes are not added up",
+			votes: []communication.Message{acceptedVote(1, 0, ballot, "a", true), acceptedVote(2, 0, ballot, "a", false)},
+		},
+		{
+			name:  "votes of hosts outside the acceptor set",
+			votes: []communication.Message{acceptedVote(1, 0, ballot, "a", false), acceptedVote(4, 0, ballot, "a", false)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, stateMachine := newTestLearner()
+			for _, message := range tt.votes {
+				l.handleAcceptedMessage(message)
+			}
+			if !reflect.DeepEqual(stateMachine.commands, tt.chosen) {
+				t.Errorf("applied %v, want %v", stateMachine.commands, tt.chosen)
+			}
+		})
+	}
+}
+
+func TestLearnerChoosesOnce(t *testing.T) {
+	first, second := communication.Ballot{Round: 1, HostID: 1}, communication.Ballot{Round: 2, HostID: 2}
+	tests := []struct {
+		name    string
+		votes   []communication.Message
+		applied []interface{}
+	}{
+		{
+			name:  "duplicate votes of one acceptor",
+			votes: []communication.Message{acceptedVote(1, 0, first, "a", false), acceptedVote(1, 0, first, "a", false)},
+		},
+		{
+			name:  "votes under different ballots",
+			votes: []communication.Message{acceptedVote(1, 0, first, "a", false), acceptedVote(2, 0, second, "a", false)},
+		},
+		{
+			name: "late votes after the value was chosen",
+			votes: []communication.Message{
+				acceptedVote(1, 0, first, "a", false), acceptedVote(2, 0, first, "a", false),
+				acceptedVote(3, 0, first, "a", false), acceptedVote(1, 0, second, "a", false), acceptedVote(2, 0, second, "a", false),
+			},
+			applied: []interface{}{"a"},
+		},
+		{
+			name: "slots chosen out of order",
+			votes: []communication.Message{
+				acceptedVote(1, 1, first, "b", false), acceptedVote(2, 1, first, "b", false),
+				acceptedVote(2, 0, first, "a", false), acceptedVote(3, 0, first, "a", false),
+			},
+			applied: []interface{}{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, stateMachine := newTestLearner()
+			for _, message := range tt.votes {
+				l.handleAcceptedMessage(message)
+			}
+			if !reflect.DeepEqual(stateMachine.commands, tt.applied) {
+				t.Errorf("applied %v, want %v", stateMachine.commands, tt.applied)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"paxos/communication"
+	"slices"
+	"time"
+)
+
+// LeasePolicy controls the lease that lets the leader serve reads locally. An acceptor that grants a lease refuses
+// to promise any other proposer until it ends, so while enough acceptors hold it no other proposer can choose a
+// value, and the leader knows every value chosen.
+type LeasePolicy struct {
+	Duration time.Duration // How long an acceptor refuses other proposers after granting a lease, 0 disables leases
+	Drift    time.Duration // Bound on how far the clocks of two nodes drift apart over one lease duration
+}
+
+// enabled reports whether leaders acquire leases.
+func (l LeasePolicy) enabled() bool {
+	return l.Duration > 0
+}
+
+// expiry returns when a lease requested at start ends for the leader. Acceptors count the duration from when they
+// receive the request, which is later, but their clocks may run faster than the leader's by up to Drift.
+func (l LeasePolicy) expiry(start time.Time) time.Time {
+	return start.Add(l.Duration - l.Drift)
+}
+
+// Validate reports whether a lease outlives the interval between two renewals, so that a leader keeps it.
+func (l LeasePolicy) Validate(renewal time.Duration) error {
+	if !l.enabled() {
+		return nil
+	}
+	if l.Drift < 0 || l.Drift >= l.Duration {
+		return fmt.Errorf("lease drift %v must be at least 0 and shorter than the lease duration %v", l.Drift, l.Duration)
+	}
+	if renewal >= l.Duration-l.Drift {
+		return fmt.Errorf("leases renewed every %v would lapse, they last %v", renewal, l.Duration-l.Drift)
+	}
+	return nil
+}
+
+// leased reports whether the acceptor holds a lease granted to a proposer other than the owner of ballot.
+func (a *Acceptor) leased(ballot communication.Ballot) bool {
+	return time.Now().Before(a.leaseExpiry) && a.leaseHolder != ballot.HostID
+}
+
+// handleLeaseMessage grants the sender a lease for its ballot, unless another proposer holds one or a higher ballot
+// was promised. Granting promises the ballot, which is made durable first. An acceptor that restarts with promises
+// in its state may have granted a lease before the crash, so it honors one for a full duration after it starts.
+func (a *Acceptor) handleLeaseMessage(message communication.Message) {
+	ballot := message.Payload.Ballot
+	if a.leaseDuration <= 0 || a.leased(ballot) {
+		return
+	}
+	slot := message.Payload.Slot
+	minProposal := a.stateManager.GetMinProposalFrom(slot)
+	if !ballot.AtLeast(minProposal) {
+		return
+	}
+	if ballot.GreaterThan(minProposal) {
+		if err := a.stateManager.UpdatePromise(slot, ballot); err != nil {
+			fmt.Printf("Failed to persist promise, not granting lease: %v\n", err)
+			return
+		}
+	}
+	a.leaseHolder = ballot.HostID
+	a.leaseExpiry = time.Now().Add(a.leaseDuration)
+	err := a.tcpCommunicator.SendLeaseGrantMessage(message.Header.SenderID, message.Header.ProposerID, slot, ballot, message.Payload.Request)
+	if err != nil {
+		fmt.Printf("Failed to send lease_grant to peer %v: %v\n", message.Header.SenderID, err)
+	}
+}
+
+// leadershipQuorumSize returns the number of acceptors that must grant a lease or confirm the leader's ballot.
+// Every set that large overlaps every Phase 1 quorum, so no other proposer can have gathered promises. The caller
+// must hold p.mu.
+func (p *Proposer) leadershipQuorumSize() int {
+	acceptors := len(p.mainAcceptors()) + len(p.auxiliaries)
+	return acceptors - p.phase1Size() + 1
+}
+
+// holdsLease reports whether this proposer leads under a lease that has not ended. The caller must hold p.mu.
+func (p *Proposer) holdsLease() bool {
+	return p.isLeader && p.leaseBallot == p.state.Ballot() && time.Now().Before(p.leaseExpiry)
+}
+
+// requestLease asks the acceptors to grant a new lease, which extends the current one once enough of them grant it.
+// No lease is requested while a reconfiguration is pending, since the acceptors that would have to grant it are
+// about to change. The caller must hold p.mu.
+func (p *Proposer) requestLease() {
+	if !p.leasePolicy.enabled() || !p.isLeader || !slices.Equal(p.mainAcceptors(), p.membership.Latest()) {
+		return
+	}
+	p.leaseRequest++
+	p.leaseRequestedAt = time.Now()
+	p.leaseGrants = make(map[int64]bool)
+	ballot := p.state.Ballot()
+	for _, acceptorID := range p.acceptors() {
+		// An acceptor that misses a request is asked again on the next heartbeat
+		_ = p.tcpCommunicator.SendLeaseMessage(acceptorID, p.proposerID, p.slot, ballot, p.leaseRequest)
+	}
+}
+
+// handleLeaseGrantMessage counts a grant for the latest lease request and extends the lease once enough acceptors
+// granted it.
+func (p *Proposer) handleLeaseGrantMessage(message communication.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ballot := p.state.Ballot()
+	if !p.isLeader || message.Payload.Request != p.leaseRequest || message.Payload.Ballot != ballot {
+		return
+	}
+	p.leaseGrants[message.Header.SenderID] = true
+	if len(p.leaseGrants) < p.leadershipQuorumSize() {
+		return
+	}
+	if !p.holdsLease() {
+		communication.LogEvent(p.id, "acquired", "lease", p.slot, nil, ballot)
+	}
+	p.leaseBallot = ballot
+	p.leaseExpiry = p.leasePolicy.expiry(p.leaseRequestedAt)
+	p.serveReads()
+}
+
+// dropLease gives up the lease, which no longer protects the values this proposer knows once a higher ballot was
+// seen or the ballot changed, and fails the lease reads waiting on it. The caller must hold p.mu.
+func (p *Proposer) dropLease() {
+	if p.holdsLease() {
+		communication.LogEvent(p.id, "revoked", "lease", p.slot, nil, p.leaseBallot)
+	}
+	p.leaseExpiry = time.Time{}
+	p.leaseGrants = make(map[int64]bool)
+	p.serveReads()
+}
@@ -0,0 +1,128 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"testing"
+	"time"
+)
+
+// newTestAcceptor returns an acceptor of host 1 that keeps its state in memory and is connected to nobody.
+func newTestAcceptor(leaseDuration time.Duration) *Acceptor {
+	stateManager, _ := NewStateManager(nil)
+	return NewAcceptor(1, nil, nil, nil, nil, nil, nil, leaseDuration, communication.NewTcpCommunicator(), stateManager, nil)
+}
+
+// ballotMessage returns a message of a proposer on another host that carries a ballot for slot 0.
+func ballotMessage(hostID int64, messageType int64, ballot communication.Ballot, request int64) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{SenderID: hostID, ProposerID: 1, MessageType: messageType},
+		Payload: communication.PaxosMessage{Ballot: ballot, Request: request},
+	}
+}
+
+func TestAcceptorLeaseRefusesOtherProposers(t *testing.T) {
+	holder := communication.Ballot{Round: 1, HostID: 2}
+	tests := []struct {
+		name          string
+		leaseDuration time.Duration
+		prepare       communication.Ballot
+		want          communication.Ballot // Ballot promised after the Prepare
+	}{
+		{
+			name:          "another proposer during the lease",
+			leaseDuration: time.Hour,
+			prepare:       communication.Ballot{Round: 5, HostID: 3},
+			want:          holder,
+		},
+		{
+			name:          "the leaseholder during the lease",
+			leaseDuration: time.Hour,
+			prepare:       communication.Ballot{Round: 5, HostID: 2},
+			want:          communication.Ballot{Round: 5, HostID: 2},
+		},
+		{
+			name:          "another proposer without leases",
+			leaseDuration: 0,
+			prepare:       communication.Ballot{Round: 5, HostID: 3},
+			want:          communication.Ballot{Round: 5, HostID: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAcceptor(tt.leaseDuration)
+			if err := a.stateManager.UpdatePromise(0, holder); err != nil {
+				t.Fatalf("UpdatePromise: %v", err)
+			}
+			a.handleLeaseMessage(ballotMessage(holder.HostID, communication.LEASE, holder, 1))
+			a.handlePrepareMessage(ballotMessage(tt.prepare.HostID, communication.PREPARE, tt.prepare, 0))
+			if promised := a.stateManager.GetMinProposalFrom(0); promised != tt.want {
+				t.Errorf("promised %v, want %v", promised, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeaseReads(t *testing.T) {
+	tests := []struct {
+		name      string
+		grants    []int64 // Acceptors that grant the lease
+		request   int64   // Lease request the grants answer, 0 for the latest one
+		revoke    bool    // Whether a higher ballot is seen before the read arrives
+		wantLease bool
+		wantErr   bool
+	}{
+		{
+			name:      "lease granted by a quorum",
+			grants:    []int64{2, 3},
+			wantLease: true,
+		},
+		{
+			name:   "lease granted by one acceptor",
+			grants: []int64{2},
+		},
+		{
+			name:    "grants for an earlier request",
+			grants:  []int64{2, 3},
+			request: -1,
+		},
+		{
+			name:      "lease revoked by a higher ballot",
+			grants:    []int64{2, 3},
+			revoke:    true,
+			wantLease: true,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProposer(ProposerConfig{LeasePolicy: LeasePolicy{Duration: time.Hour, Drift: time.Minute}})
+			elect(p, nil)
+			for _, acceptorID := range tt.grants {
+				p.handleLeaseGrantMessage(ballotMessage(acceptorID, communication.LEASE_GRANT, p.state.Ballot(), p.leaseRequest+tt.request))
+			}
+			if p.holdsLease() != tt.wantLease {
+				t.Fatalf("holds a lease %v, want %v", p.holdsLease(), tt.wantLease)
+			}
+
+			if tt.revoke {
+				p.handleHeartbeatMessage(heartbeatFrom(2, 0, communication.Ballot{Round: 9, HostID: 2}))
+				if p.holdsLease() {
+					t.Fatalf("holds a lease after a higher ballot was seen")
+				}
+			}
+
+			reply := make(chan ReadResult, 1)
+			p.handleReadRequest(ReadRequest{Reply: reply})
+			select {
+			case result := <-reply:
+				if (result.Err != nil) != tt.wantErr || (result.Err == nil && (!result.Lease || result.Slot != -1)) {
+					t.Errorf("read answered with %+v, want a lease read of slot -1 or an error %v", result, tt.wantErr)
+				}
+			default:
+				if tt.wantLease {
+					t.Errorf("read not answered, want it answered")
+				}
+			}
+		})
+	}
+}
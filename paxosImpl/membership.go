@@ -0,0 +1,197 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"maps"
+	"paxos/communication"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// reconfigurationPrefix marks the log values that change the acceptor set of an instance.
+const reconfigurationPrefix = "reconfigure:"
+
+// Reconfiguration is a change to the acceptor set of an instance, agreed through the log like any other value.
+// It is written "reconfigure:add:<host ID>" or "reconfigure:remove:<host ID>".
+type Reconfiguration struct {
+	Add    bool  // Whether the host joins the acceptor set, or leaves it
+	HostID int64 // Line number of the host in the hostfile
+}
+
+// ParseReconfiguration returns the reconfiguration a log value or command describes, and false for ordinary values.
+func ParseReconfiguration(value interface{}) (Reconfiguration, bool) {
+	s, ok := communication.CommandValue(value).(string)
+	if !ok || !strings.HasPrefix(s, reconfigurationPrefix) {
+		return Reconfiguration{}, false
+	}
+	op, id, found := strings.Cut(strings.TrimPrefix(s, reconfigurationPrefix), ":")
+	hostID, err := strconv.ParseInt(id, 10, 64)
+	if !found || err != nil || (op != "add" && op != "remove") {
+		return Reconfiguration{}, false
+	}
+	return Reconfiguration{Add: op == "add", HostID: hostID}, true
+}
+
+// String returns the log value that describes the reconfiguration.
+func (r Reconfiguration) String() string {
+	op := "remove"
+	if r.Add {
+		op = "add"
+	}
+	return fmt.Sprintf("%v%v:%v", reconfigurationPrefix, op, r.HostID)
+}
+
+// configuration is the acceptor set in effect from a slot on.
+type configuration struct {
+	fromSlot  int64
+	acceptors []int64
+}
+
+// Membership tracks the acceptor set of one instance across the slots of its log, and is shared by the roles of the
+// instance on a host. A reconfiguration chosen in slot s takes effect at slot s + delay, so every node agrees on
+// the acceptor set of each slot no matter when it learns the entry. Reconfigurations that would leave quorum sizes
+// unsafe are ignored, which every node decides the same way.
+type Membership struct {
+	id           int64                     // Host ID of the node, for the log
+	initial      []int64                   // Acceptor set from the hostfile, in effect from slot 0
+	changes      map[int64]Reconfiguration // Reconfigurations by the slot they were chosen in
+	configs      []configuration           // Acceptor sets ordered by the slot they take effect at
+	delay        int64                     // Slots between a reconfiguration and the slot it takes effect at
+	quorumPolicy QuorumPolicy              // Quorum sizes every acceptor set must support
+	auxiliaries  int                       // Auxiliary acceptors counted in every quorum size
+	onChange     func(added, removed []int64)
+	mu           sync.RWMutex
+}
+
+// NewMembership initializes the membership of an instance with its acceptor set from the hostfile. onChange is
+// called with the hosts that joined or left the latest acceptor set whenever a reconfiguration is applied.
+func NewMembership(id int64, acceptors []int64, delay int64, quorumPolicy QuorumPolicy, auxiliaries int, onChange func(added, removed []int64)) *Membership {
+	return &Membership{
+		id:           id,
+		initial:      acceptors,
+		changes:      make(map[int64]Reconfiguration),
+		configs:      []configuration{{fromSlot: 0, acceptors: acceptors}},
+		delay:        max(delay, 1),
+		quorumPolicy: quorumPolicy,
+		auxiliaries:  auxiliaries,
+		onChange:     onChange,
+	}
+}
+
+// Acceptors returns the acceptor set in effect at a slot.
+func (m *Membership) Acceptors(slot int64) []int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	acceptors := m.configs[0].acceptors
+	for _, config := range m.configs {
+		if config.fromSlot > slot {
+			break
+		}
+		acceptors = config.acceptors
+	}
+	return acceptors
+}
+
+// Latest returns the acceptor set of the last configuration, which may not be in effect yet.
+func (m *Membership) Latest() []int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.configs[len(m.configs)-1].acceptors
+}
+
+// Apply records the value chosen in a slot and reports whether it was a reconfiguration not applied before.
+// Entries may be applied in any order.
+func (m *Membership) Apply(slot int64, value interface{}) bool {
+	change, ok := ParseReconfiguration(value)
+	if !ok {
+		return false
+	}
+	m.mu.Lock()
+	if _, applied := m.changes[slot]; applied {
+		m.mu.Unlock()
+		return false
+	}
+	previous := m.configs[len(m.configs)-1].acceptors
+	m.changes[slot] = change
+	m.rebuild()
+	latest := m.configs[len(m.configs)-1].acceptors
+	m.mu.Unlock()
+
+	communication.LogEvent(m.id, "reconfigured", "membership", slot+m.delay, value, communication.Ballot{})
+	added, removed := difference(latest, previous), difference(previous, latest)
+	if m.onChange != nil && (len(added) > 0 || len(removed) > 0) {
+		m.onChange(added, removed)
+	}
+	return true
+}
+
+// Reconfigurations returns the reconfigurations applied so far that were chosen at or below a slot, ordered by slot,
+// so that a snapshot of the slots up to it can carry them.
+func (m *Membership) Reconfigurations(upTo int64) []communication.LogEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := []communication.LogEntry{}
+	for _, slot := range slices.Sorted(maps.Keys(m.changes)) {
+		if slot <= upTo {
+			entries = append(entries, communication.LogEntry{Slot: slot, Value: m.changes[slot].String()})
+		}
+	}
+	return entries
+}
+
+// rebuild recomputes the acceptor sets from the initial one by applying every reconfiguration in slot order.
+// The caller must hold m.mu.
+func (m *Membership) rebuild() {
+	slots := make([]int64, 0, len(m.changes))
+	for slot := range m.changes {
+		slots = append(slots, slot)
+	}
+	slices.Sort(slots)
+
+	m.configs = []configuration{{fromSlot: 0, acceptors: m.initial}}
+	acceptors := m.initial
+	for _, slot := range slots {
+		change := m.changes[slot]
+		next := slices.DeleteFunc(slices.Clone(acceptors), func(id int64) bool { return id == change.HostID })
+		if change.Add {
+			next = append(next, change.HostID)
+			slices.Sort(next)
+		}
+		if slices.Equal(next, acceptors) {
+			continue
+		}
+		if err := m.quorumPolicy.Validate(len(next) + m.auxiliaries); err != nil {
+			fmt.Printf("Ignoring reconfiguration chosen in slot %v: %v\n", slot, err)
+			continue
+		}
+		acceptors = next
+		m.configs = append(m.configs, configuration{fromSlot: slot + m.delay, acceptors: acceptors})
+	}
+}
+
+// difference returns the hosts of a that are not in b.
+func difference(a []int64, b []int64) []int64 {
+	hosts := []int64{}
+	for _, id := range a {
+		if !slices.Contains(b, id) {
+			hosts = append(hosts, id)
+		}
+	}
+	return hosts
+}
+
+// announceReconfiguration tells the other proposer hosts of the instance about a reconfiguration chosen in a slot,
+// so that a follower taking over uses the right acceptor set. Learners find out by learning the slot. The caller
+// must hold p.mu.
+func (p *Proposer) announceReconfiguration(slot int64, value interface{}) {
+	for _, peerID := range p.peers {
+		if peerID == p.id {
+			continue
+		}
+		if err := p.tcpCommunicator.SendConfigureMessage(peerID, p.proposerID, slot, value); err != nil {
+			fmt.Printf("Failed to send configure to peer %v: %v\n", peerID, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"reflect"
+	"testing"
+)
+
+// chosenValue is a value chosen in a slot, applied to a Membership in the order of the test.
+type chosenValue struct {
+	slot  int64
+	value interface{}
+}
+
+func TestMembershipRebuild(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    QuorumPolicy
+		applied   []chosenValue
+		wantNew   []bool            // What Apply reports for each value
+		acceptors map[int64][]int64 // Expected acceptor set at each slot
+		latest    []int64
+	}{
+		{
+			name:      "add takes effect after the delay",
+			applied:   []chosenValue{{slot: 4, value: "reconfigure:add:5"}},
+			wantNew:   []bool{true},
+			acceptors: map[int64][]int64{0: {1, 2, 3}, 5: {1, 2, 3}, 6: {1, 2, 3, 5}, 100: {1, 2, 3, 5}},
+			latest:    []int64{1, 2, 3, 5},
+		},
+		{
+			name:      "entries applied out of order",
+			applied:   []chosenValue{{slot: 8, value: "reconfigure:remove:2"}, {slot: 3, value: "reconfigure:add:4"}},
+			wantNew:   []bool{true, true},
+			acceptors: map[int64][]int64{4: {1, 2, 3}, 5: {1, 2, 3, 4}, 9: {1, 2, 3, 4}, 10: {1, 3, 4}},
+			latest:    []int64{1, 3, 4},
+		},
+		{
+			name:      "ordinary values and commands",
+			applied:   []chosenValue{{slot: 0, value: "x"}, {slot: 1, value: communication.Command{Origin: 1, Seq: 1, Value: "reconfigure:add:7"}}, {slot: 2, value: int64(3)}},
+			wantNew:   []bool{false, true, false},
+			acceptors: map[int64][]int64{2: {1, 2, 3}, 3: {1, 2, 3, 7}},
+			latest:    []int64{1, 2, 3, 7},
+		},
+		{
+			name:      "slot applied twice",
+			applied:   []chosenValue{{slot: 2, value: "reconfigure:remove:3"}, {slot: 2, value: "reconfigure:remove:3"}},
+			wantNew:   []bool{true, false},
+			acceptors: map[int64][]int64{3: {1, 2, 3}, 4: {1, 2}},
+			latest:    []int64{1, 2},
+		},
+		{
+			name:      "removing a host that is not an acceptor",
+			applied:   []chosenValue{{slot: 1, value: "reconfigure:remove:9"}},
+			wantNew:   []bool{true},
+			acceptors: map[int64][]int64{0: {1, 2, 3}, 10: {1, 2, 3}},
+			latest:    []int64{1, 2, 3},
+		},
+		{
+			name:   "unsafe set skipped while later changes apply",
+			policy: QuorumPolicy{Phase1: 2, Phase2: 2},
+			applied: []chosenValue{
+				{slot: 1, value: "reconfigure:remove:3"},
+				{slot: 2, value: "reconfigure:remove:2"},
+				{slot: 3, value: "reconfigure:add:4"},
+			},
+			wantNew:   []bool{true, true, true},
+			acceptors: map[int64][]int64{2: {1, 2, 3}, 3: {1, 2}, 4: {1, 2}, 5: {1, 2, 4}},
+			latest:    []int64{1, 2, 4},
+		},
+		{
+			name:      "malformed reconfigurations are ordinary values",
+			applied:   []chosenValue{{slot: 1, value: "reconfigure:add:x"}, {slot: 2, value: "reconfigure:swap:4"}},
+			wantNew:   []bool{false, false},
+			acceptors: map[int64][]int64{10: {1, 2, 3}},
+			latest:    []int64{1, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMembership(1, []int64{1, 2, 3}, 2, tt.policy, 0, nil)
+			for i, chosen := range tt.applied {
+				if got := m.Apply(chosen.slot, chosen.value); got != tt.wantNew[i] {
+					t.Errorf("Apply(%v, %v) = %v, want %v", chosen.slot, chosen.value, got, tt.wantNew[i])
+				}
+			}
+			for slot, want := range tt.acceptors {
+				if got := m.Acceptors(slot); !reflect.DeepEqual(got, want) {
+					t.Errorf("Acceptors(%v) = %v, want %v", slot, got, want)
+				}
+			}
+			if got := m.Latest(); !reflect.DeepEqual(got, tt.latest) {
+				t.Errorf("Latest() = %v, want %v", got, tt.latest)
+			}
+		})
+	}
+}
+
+func TestMembershipReconfigurationsRestore(t *testing.T) {
+	m := NewMembership(1, []int64{1, 2, 3}, 1, QuorumPolicy{}, 0, nil)
+	m.Apply(6, "reconfigure:remove:1")
+	m.Apply(2, "reconfigure:add:4")
+	m.Apply(9, "reconfigure:add:5")
+
+	// A snapshot of slot 6 carries the reconfigurations chosen up to it, and restores the acceptor sets they lead to
+	entries := m.Reconfigurations(6)
+	want := []communication.LogEntry{{Slot: 2, Value: "reconfigure:add:4"}, {Slot: 6, Value: "reconfigure:remove:1"}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("Reconfigurations(6) = %v, want %v", entries, want)
+	}
+	restored := NewMembership(2, []int64{1, 2, 3}, 1, QuorumPolicy{}, 0, nil)
+	for _, entry := range entries {
+		restored.Apply(entry.Slot, entry.Value)
+	}
+	for _, slot := range []int64{0, 3, 7, 9} {
+		if got, want := restored.Acceptors(slot), m.Acceptors(slot); !reflect.DeepEqual(got, want) {
+			t.Errorf("restored Acceptors(%v) = %v, want %v", slot, got, want)
+		}
+	}
+}
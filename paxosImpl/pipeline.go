@@ -0,0 +1,123 @@
+package paxosImpl
+
+import (
+	"maps"
+	"paxos/communication"
+	"slices"
+)
+
+// inflightSlot is a slot the leader sent an Accept for that has not been chosen yet.
+type inflightSlot struct {
+	value    interface{}    // The value proposed in the slot
+	own      bool           // Whether the value was taken off the queue, and goes back to it if the slot is abandoned
+	accepted map[int64]bool // Acceptors that accepted the value under the current ballot
+}
+
+// fillPipeline opens slots in order, from the lowest one not opened yet, as long as they lie within the window
+// above the lowest undecided slot. Each slot gets the value recovered for it in Phase 1, or the next batch from the
+// queue. A batch that is not full waits for the batch window when wait is set and nothing is in flight, since
+// commands queue up anyway while slots are in flight. With the queue empty, a slot below the highest recovered one
+// gets a no-op, since the slots above a gap could never be reported.
+//
+// Every slot in flight uses the acceptor set that promised the current ballot. The membership delay is never
+// shorter than the window, so the acceptor set of every slot in the window is known, and filling stops at the first
+// slot where it changes until the earlier slots are decided and the new set has promised. The caller must hold p.mu.
+func (p *Proposer) fillPipeline(wait bool) {
+	if !p.isLeader {
+		return
+	}
+	p.nextSlot = max(p.nextSlot, p.slot)
+	for p.nextSlot < p.slot+int64(p.window) {
+		slot := p.nextSlot
+		if _, done := p.chosen[slot]; done {
+			p.nextSlot++
+			continue
+		}
+		if !slices.Equal(p.prepared, p.membership.Acceptors(slot)) {
+			return
+		}
+		if entry, ok := p.recovered[slot]; ok {
+			p.accept(slot, entry.Value, p.reclaimed[slot])
+		} else if len(p.pending) > 0 {
+			if wait && len(p.inflight) == 0 && p.waitForBatch() {
+				return
+			}
+			value := p.nextValue()
+			p.accept(slot, value, p.dequeue(value))
+		} else if p.recoveredAbove(slot) {
+			// Acceptors report no entry for a nil value, so the gap gets a value of its own
+			p.accept(slot, communication.Noop{}, false)
+		} else {
+			return
+		}
+		p.nextSlot++
+	}
+}
+
+// recoveredAbove reports whether Phase 1 recovered a value for a slot above the given one that is not chosen yet.
+// The caller must hold p.mu.
+func (p *Proposer) recoveredAbove(slot int64) bool {
+	for recovered := range p.recovered {
+		if recovered > slot {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver reports the chosen values in slot order, from the lowest undecided slot up to the first gap, hands them to
+// the applier, and applies the reconfigurations among them. Slots chosen out of order wait here for the slots below
+// them. The caller must hold p.mu.
+func (p *Proposer) deliver() {
+	progressed := false
+	for {
+		value, ok := p.chosen[p.slot]
+		if !ok {
+			break
+		}
+		delete(p.chosen, p.slot)
+		// Each command of a batch is reported on its own, the way it was submitted
+		for _, command := range communication.Commands(value) {
+			communication.LogEvent(p.id, "chose", "chose", p.slot, command, p.state.Ballot())
+		}
+		if p.membership.Apply(p.slot, value) {
+			p.announceReconfiguration(p.slot, value)
+			p.dropLease()
+		}
+		p.applier.Deliver(p.slot, value)
+		p.slot++
+		progressed = true
+	}
+	if !progressed {
+		return
+	}
+	p.serveReads()
+	// The phase timeout bounds the wait for the lowest undecided slot, so it starts over whenever that slot moves
+	if len(p.inflight) > 0 || p.phase == phaseFast {
+		p.resetTimer(p.retryPolicy.PhaseTimeout)
+	}
+	p.releaseAuxiliaries()
+	p.proposeNext()
+}
+
+// abandonPipeline gives up the slots in flight. Values taken off the queue go back to its head in slot order. The
+// next Phase 1 recovers any of them that acceptors already accepted, and takes them off the queue again. Slots
+// already chosen are kept. The caller must hold p.mu.
+func (p *Proposer) abandonPipeline() {
+	returned := []interface{}{}
+	for _, slot := range slices.Sorted(maps.Keys(p.inflight)) {
+		if entry := p.inflight[slot]; entry.own {
+			returned = append(returned, communication.Commands(entry.value)...)
+		}
+	}
+	p.pending = append(returned, p.pending...)
+	p.inflight = make(map[int64]*inflightSlot)
+}
+
+// headValue returns the value proposed for the lowest undecided slot, for the log. The caller must hold p.mu.
+func (p *Proposer) headValue() interface{} {
+	if entry, ok := p.inflight[p.slot]; ok {
+		return entry.value
+	}
+	return p.value
+}
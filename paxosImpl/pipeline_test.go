@@ -0,0 +1,144 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"reflect"
+	"testing"
+)
+
+func TestPipelineFillsGapsBelowRecoveredSlots(t *testing.T) {
+	// Values accepted under the ballot of a previous leader
+	previous := communication.Ballot{Round: 1, HostID: 2}
+	tests := []struct {
+		name     string
+		window   int
+		queued   []interface{}
+		reported map[int64][]communication.LogEntry
+		want     map[int64]interface{} // Value proposed in each slot
+		applied  []interface{}
+	}{
+		{
+			name:     "gap below a recovered slot",
+			window:   1,
+			reported: map[int64][]communication.LogEntry{2: {{Slot: 1, Ballot: previous, Value: "x"}}},
+			want:     map[int64]interface{}{0: communication.Noop{}, 1: "x"},
+			applied:  []interface{}{"x"},
+		},
+		{
+			name:   "gaps in a window",
+			window: 4,
+			reported: map[int64][]communication.LogEntry{
+				2: {{Slot: 0, Ballot: previous, Value: "a"}},
+				3: {{Slot: 3, Ballot: previous, Value: "b"}},
+			},
+			want:    map[int64]interface{}{0: "a", 1: communication.Noop{}, 2: communication.Noop{}, 3: "b"},
+			applied: []interface{}{"a", "b"},
+		},
+		{
+			name:     "gap wider than the window",
+			window:   2,
+			reported: map[int64][]communication.LogEntry{3: {{Slot: 4, Ballot: previous, Value: "x"}}},
+			want: map[int64]interface{}{
+				0: communication.Noop{}, 1: communication.Noop{}, 2: communication.Noop{}, 3: communication.Noop{}, 4: "x",
+			},
+			applied: []interface{}{"x"},
+		},
+		{
+			name:     "queued command fills the gap",
+			window:   1,
+			queued:   []interface{}{"y"},
+			reported: map[int64][]communication.LogEntry{2: {{Slot: 1, Ballot: previous, Value: "x"}}},
+			want:     map[int64]interface{}{0: "y", 1: "x"},
+			applied:  []interface{}{"y", "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, stateMachine := newTestProposer(ProposerConfig{Window: tt.window})
+			p.state.ObserveBallot(previous)
+			for _, value := range tt.queued {
+				p.sendProposal(value)
+			}
+			elect(p, tt.reported)
+
+			proposed := acceptInflight(p)
+			for slot, value := range proposed {
+				proposed[slot] = communication.CommandValue(value)
+			}
+			if !reflect.DeepEqual(proposed, tt.want) {
+				t.Errorf("proposed %v, want %v", proposed, tt.want)
+			}
+			if !reflect.DeepEqual(stateMachine.commands, tt.applied) {
+				t.Errorf("applied %v, want %v", stateMachine.commands, tt.applied)
+			}
+			if p.slot != int64(len(tt.want)) || p.phase != phaseIdle {
+				t.Errorf("slot %v in phase %v after the recovered slots were chosen, want slot %v idle", p.slot, p.phase, len(tt.want))
+			}
+		})
+	}
+}
+
+// inflightValues returns the value of each slot in flight.
+func inflightValues(p *Proposer) map[int64]interface{} {
+	values := make(map[int64]interface{})
+	for slot, entry := range p.inflight {
+		values[slot] = communication.CommandValue(entry.value)
+	}
+	return values
+}
+
+func TestPipelineWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		window   int
+		order    []int64                 // Slots the acceptors accept, in order
+		inflight []map[int64]interface{} // Slots in flight after each slot is accepted
+		applied  [][]interface{}         // Values applied after each slot is accepted
+	}{
+		{
+			name:     "slots in order",
+			window:   2,
+			order:    []int64{0, 1, 2},
+			inflight: []map[int64]interface{}{{1: "b", 2: "c"}, {2: "c"}, {}},
+			applied:  [][]interface{}{{"a"}, {"a", "b"}, {"a", "b", "c"}},
+		},
+		{
+			name:     "later slot chosen first",
+			window:   2,
+			order:    []int64{1, 0, 2},
+			inflight: []map[int64]interface{}{{0: "a"}, {2: "c"}, {}},
+			applied:  [][]interface{}{nil, {"a", "b"}, {"a", "b", "c"}},
+		},
+		{
+			name:     "window of one",
+			window:   1,
+			order:    []int64{0, 1, 2},
+			inflight: []map[int64]interface{}{{1: "b"}, {2: "c"}, {}},
+			applied:  [][]interface{}{{"a"}, {"a", "b"}, {"a", "b", "c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, stateMachine := newTestProposer(ProposerConfig{Window: tt.window})
+			for _, value := range []interface{}{"a", "b", "c"} {
+				p.sendProposal(value)
+			}
+			elect(p, nil)
+			if len(p.inflight) != tt.window {
+				t.Fatalf("%v slots in flight after Phase 1, want %v", len(p.inflight), tt.window)
+			}
+			for i, slot := range tt.order {
+				value := p.inflight[slot].value
+				for _, acceptorID := range []int64{2, 3} {
+					p.handleAcceptedMessage(acceptedFrom(p, acceptorID, slot, value))
+				}
+				if inflight := inflightValues(p); !reflect.DeepEqual(inflight, tt.inflight[i]) {
+					t.Errorf("in flight %v after slot %v was accepted, want %v", inflight, slot, tt.inflight[i])
+				}
+				if !reflect.DeepEqual(stateMachine.commands, tt.applied[i]) {
+					t.Errorf("applied %v after slot %v was accepted, want %v", stateMachine.commands, slot, tt.applied[i])
+				}
+			}
+		})
+	}
+}
@@ -2,89 +2,348 @@ package paxosImpl
 
 import (
 	"fmt"
+	"maps"
 	"paxos/communication"
+	"slices"
 	"sync"
+	"time"
 )
 
-// Proposer represents a Paxos proposer that initiates the Prepare and Accept phases.
+// Phases of a single proposal round.
+const (
+	phaseIdle    = iota // No round is in progress
+	phasePrepare        // Waiting for a majority of Promise messages
+	phaseAccept         // Waiting for a majority of Accepted messages in the slots in flight
+	phaseBackoff        // Waiting before retrying with a higher ballot
+	phaseFast           // Waiting for a fast quorum to accept a value sent directly to the acceptors
+	phaseBatch          // Waiting for more commands to join the batch of the current slot
+)
+
+// Proposer represents a Paxos proposer that places values into consecutive slots of the replicated log.
 type Proposer struct {
-	id                 int64                          // Unique ID for the Proposer
-	proposalNumber     int64                          // The proposal number for this instance
-	minProposalNumber  int64                          // The minimum proposal number seen so far
-	value              interface{}                    // The value the Proposer wants to propose
-	acceptedValue      interface{}                    // The value that has been accepted
-	quorum             []int64                        // The set of acceptor IDs to communicate with
-	promiseResponses   int64                          // Tracks the responses from Acceptors
-	acceptResponses    int64                          // Tracks the responses from Acceptors
-	stateManager       *StateManager                  // StateManager to manage shared state
-	tcpCommunicator    *communication.TcpCommunicator // Communicator to send and receive messages
-	promiseMessagesCh  chan communication.Message     // Channel to receive Promise messages
-	acceptedMessagesCh chan communication.Message     // Channel to receive Accepted messages
-	sendProposalCh     chan bool                      // Channel to send proposal
-	mu                 sync.Mutex                     // Mutex for thread-safe updates to responses
-}
-
-// NewProposer initializes a new Proposer instance.
-func NewProposer(id int64, proposalNumber int64, value interface{}, quorum []int64, promiseMessagesCh chan communication.Message,
-	acceptedMessagesCh chan communication.Message, sendProposalCh chan bool, tcpCommunicator *communication.TcpCommunicator, stateManager *StateManager) *Proposer {
+	id               int64                              // Host ID of the node running the Proposer
+	proposerID       int64                              // Proposer number from the hostfile, naming the instance
+	slot             int64                              // The lowest slot whose chosen value has not been reported yet
+	nextSlot         int64                              // The lowest slot the leader has not sent an Accept for yet
+	window           int                                // Most slots above the lowest undecided one that the leader fills at once
+	inflight         map[int64]*inflightSlot            // Slots sent to the acceptors and not chosen yet, each with its own votes
+	chosen           map[int64]interface{}              // Values chosen above a slot that is still undecided, reported in slot order
+	pending          []interface{}                      // Values waiting to be placed in the log
+	commandSeq       int64                              // Sequence number of the latest command taken from a client, seeded from the clock so a restarted proposer never reuses one
+	value            interface{}                        // The value sent with Prepare, or proposed in the current fast round
+	recovered        map[int64]communication.LogEntry   // Entries recovered in Phase 1, to be proposed again
+	reclaimed        map[int64]bool                     // Recovered slots whose value was taken off our own queue
+	reported         map[int64][]communication.LogEntry // Accepted entries reported by each acceptor that promised
+	compacted        int64                              // Highest slot below which an acceptor that promised discarded its state
+	membership       *Membership                        // The acceptor set of each slot, changed by reconfigurations in the log
+	applier          *Applier                           // Applies the chosen commands to the state machine of the node, which reads are answered from
+	prepared         []int64                            // The acceptor set that promised the current ballot
+	auxiliaries      []int64                            // Auxiliary acceptors, engaged only while a main acceptor is unreachable
+	auxEngaged       bool                               // Whether rounds are currently sent to the auxiliary acceptors too
+	mainSeen         map[int64]bool                     // Main acceptors that answered since the auxiliaries were engaged
+	unreplicated     map[int64]*unreplicatedSlot        // Slots chosen with auxiliary votes that some main acceptor has not accepted
+	quorumPolicy     QuorumPolicy                       // Quorum sizes, applied to the acceptor set of the current slot
+	fastMode         bool                               // Whether the leader fills free slots with Fast Paxos rounds
+	anyBallot        communication.Ballot               // Ballot under which a fast round was opened, zero when none
+	fastVotes        map[int64]map[int64]interface{}    // Client value accepted by each acceptor in each undecided slot of the fast round
+	peers            []int64                            // Host IDs running proposers of the same instance, the audience of heartbeats
+	isLeader         bool                               // Whether this proposer holds the promises of a majority for its ballot
+	leaderHost       int64                              // Host ID of the known leader, 0 when none is known
+	leaderBallot     communication.Ballot               // Ballot announced by the known leader
+	leaderDeadline   time.Time                          // When the known leader is suspected unless it sends a heartbeat
+	leaderPolicy     LeaderPolicy                       // Heartbeat interval and election timeout
+	phase            int                                // The phase of the current round
+	attempts         int                                // Rounds started for the current value
+	retryPolicy      RetryPolicy                        // Phase timeouts and backoff between rounds
+	batchPolicy      BatchPolicy                        // How queued commands are gathered into batches
+	leasePolicy      LeasePolicy                        // How long leases last and how far clocks may drift
+	leaseRequest     int64                              // Number of the latest lease request
+	leaseRequestedAt time.Time                          // When the latest lease request was sent
+	leaseGrants      map[int64]bool                     // Acceptors that granted the latest lease request
+	leaseBallot      communication.Ballot               // Ballot the current lease was granted to
+	leaseExpiry      time.Time                          // When the current lease ends for this proposer
+	confirmRequest   int64                              // Number of the latest confirmation round for ReadIndex reads
+	confirmedRequest int64                              // Number of the latest confirmation round a quorum answered
+	confirmations    map[int64]bool                     // Acceptors that confirmed the ballot in the latest round
+	reads            []pendingRead                      // Reads waiting for slots to be applied
+	timer            *time.Timer                        // Fires when the current phase times out or the backoff ends
+	state            *ProposerState                     // Ballot and vote bookkeeping of this proposer
+	tcpCommunicator  *communication.TcpCommunicator     // Communicator to send and receive messages
+	inbox            ProposerInbox                      // Channels to receive messages, client values and reads
+	mu               sync.Mutex                         // Mutex for thread-safe updates to responses
+}
+
+// ProposerConfig holds the settings of a Proposer, which stay fixed while it runs.
+type ProposerConfig struct {
+	ID           int64        // Host ID of the node running the Proposer
+	ProposerID   int64        // Proposer number from the hostfile, naming the instance
+	Auxiliaries  []int64      // Auxiliary acceptors, engaged only while a main acceptor is unreachable
+	Peers        []int64      // Host IDs running proposers of the same instance
+	QuorumPolicy QuorumPolicy // Quorum sizes, counting both the main and the auxiliary acceptors
+	FastMode     bool         // Whether the leader fills free slots with Fast Paxos rounds
+	RetryPolicy  RetryPolicy  // Phase timeouts and backoff between rounds
+	LeaderPolicy LeaderPolicy // Heartbeat interval and election timeout
+	BatchPolicy  BatchPolicy  // How queued commands are gathered into batches
+	Window       int          // Most slots the leader keeps in the Accept phase at once
+	LeasePolicy  LeasePolicy  // How long leases last and how far clocks may drift
+}
+
+// ProposerInbox holds the channels through which a Proposer receives messages, client values and reads. The
+// message channels belong to one proposer, while client values and reads may be shared by every proposer of a host.
+type ProposerInbox struct {
+	PromiseMessagesCh   chan communication.Message // Channel to receive Promise messages
+	AcceptedMessagesCh  chan communication.Message // Channel to receive Accepted messages
+	NackMessagesCh      chan communication.Message // Channel to receive Prepare and Accept rejections
+	HeartbeatMessagesCh chan communication.Message // Channel to receive heartbeats from the leader
+	ForwardMessagesCh   chan communication.Message // Channel to receive values forwarded by other proposers
+	LeaseMessagesCh     chan communication.Message // Channel to receive lease grants and ballot confirmations from acceptors
+	SendProposalCh      chan interface{}           // Channel to receive values to propose
+	ReadCh              chan ReadRequest           // Channel to receive reads of the latest applied value
+}
+
+// NewProposerInbox returns an inbox with message channels of its own, which takes client values and reads from the
+// given channels.
+func NewProposerInbox(sendProposalCh chan interface{}, readCh chan ReadRequest) ProposerInbox {
+	return ProposerInbox{
+		PromiseMessagesCh:   make(chan communication.Message),
+		AcceptedMessagesCh:  make(chan communication.Message),
+		NackMessagesCh:      make(chan communication.Message),
+		HeartbeatMessagesCh: make(chan communication.Message),
+		ForwardMessagesCh:   make(chan communication.Message),
+		LeaseMessagesCh:     make(chan communication.Message),
+		SendProposalCh:      sendProposalCh,
+		ReadCh:              readCh,
+	}
+}
+
+// NewProposer initializes a new Proposer instance. Quorum sizes count both the main and the auxiliary acceptors.
+// The leader keeps up to config.Window slots in the Accept phase at once, delivers the chosen values to the applier
+// of the node, and serves reads from its state machine.
+func NewProposer(config ProposerConfig, membership *Membership, applier *Applier, inbox ProposerInbox, tcpCommunicator *communication.TcpCommunicator,
+	state *ProposerState) *Proposer {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
 	return &Proposer{
-		id:                 int64(id),
-		proposalNumber:     int64(proposalNumber),
-		value:              value,
-		quorum:             quorum,
-		promiseResponses:   0,
-		acceptResponses:    0,
-		stateManager:       stateManager,
-		tcpCommunicator:    tcpCommunicator,
-		promiseMessagesCh:  promiseMessagesCh,
-		acceptedMessagesCh: acceptedMessagesCh,
-		sendProposalCh:     sendProposalCh,
-		minProposalNumber:  0,
-		acceptedValue:      nil,
-	}
-}
-
-// Prepare initiates the Prepare phase by sending Prepare messages to the quorum.
-func (p *Proposer) sendProposal() {
+		id:              config.ID,
+		proposerID:      config.ProposerID,
+		slot:            0,
+		nextSlot:        0,
+		window:          max(config.Window, 1),
+		inflight:        make(map[int64]*inflightSlot),
+		chosen:          make(map[int64]interface{}),
+		pending:         []interface{}{},
+		commandSeq:      time.Now().UnixNano(),
+		membership:      membership,
+		applier:         applier,
+		auxiliaries:     config.Auxiliaries,
+		quorumPolicy:    config.QuorumPolicy,
+		fastMode:        config.FastMode,
+		peers:           config.Peers,
+		isLeader:        false,
+		leaderHost:      0,
+		leaderDeadline:  config.LeaderPolicy.electionDeadline(time.Now()),
+		leaderPolicy:    config.LeaderPolicy,
+		phase:           phaseIdle,
+		attempts:        0,
+		retryPolicy:     config.RetryPolicy,
+		batchPolicy:     config.BatchPolicy,
+		leasePolicy:     config.LeasePolicy,
+		leaseGrants:     make(map[int64]bool),
+		confirmations:   make(map[int64]bool),
+		timer:           timer,
+		state:           state,
+		tcpCommunicator: tcpCommunicator,
+		inbox:           inbox,
+		recovered:       make(map[int64]communication.LogEntry),
+		reclaimed:       make(map[int64]bool),
+		reported:        make(map[int64][]communication.LogEntry),
+		unreplicated:    make(map[int64]*unreplicatedSlot),
+	}
+}
+
+// majority returns the smallest number of acceptors that forms a majority of n.
+func majority(n int) int {
+	return n/2 + 1
+}
+
+// mainAcceptors returns the acceptor set of the current slot, without the auxiliary acceptors. The caller must hold p.mu.
+func (p *Proposer) mainAcceptors() []int64 {
+	return p.membership.Acceptors(p.slot)
+}
+
+// phase1Size returns the number of acceptors that must promise a ballot for the current slot. The caller must hold p.mu.
+func (p *Proposer) phase1Size() int {
+	return p.quorumPolicy.phase1Size(len(p.mainAcceptors()) + len(p.auxiliaries))
+}
+
+// phase2Size returns the number of acceptors that must accept a value in a classic round for the current slot.
+// The caller must hold p.mu.
+func (p *Proposer) phase2Size() int {
+	return p.quorumPolicy.phase2Size(len(p.mainAcceptors()) + len(p.auxiliaries))
+}
+
+// fastQuorumSize returns the number of acceptors that must accept a value in a fast round for the current slot.
+// The caller must hold p.mu.
+func (p *Proposer) fastQuorumSize() int {
+	return p.quorumPolicy.fastSize(len(p.mainAcceptors()) + len(p.auxiliaries))
+}
+
+// sendProposal turns a client value into a command of its own, then forwards it to the live leader, or queues it
+// locally when this proposer leads or no leader is known.
+func (p *Proposer) sendProposal(value interface{}) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.commandSeq++
+	command := communication.Command{Origin: p.id, Seq: p.commandSeq, Value: value}
+	if p.hasLiveLeader() {
+		err := p.tcpCommunicator.SendForwardMessage(p.leaderHost, p.proposerID, command)
+		if err == nil {
+			return
+		}
+		fmt.Printf("Failed to forward to leader %v, proposing locally: %v\n", p.leaderHost, err)
+	}
+	p.enqueue(command)
+}
+
+// enqueue queues a value for the log and starts a round if none is in progress. A leader with room in its
+// window opens a slot for the value right away. The caller must hold p.mu.
+func (p *Proposer) enqueue(value interface{}) {
+	p.pending = append(p.pending, value)
+	switch {
+	case p.phase == phaseIdle:
+		p.proposeNext()
+	case p.phase == phaseAccept:
+		p.fillPipeline(true)
+	case p.phase == phaseBatch && len(p.pending) >= p.batchPolicy.MaxSize:
+		p.fillPipeline(false)
+	}
+}
+
+// proposeNext fills the free slots of the window. A leader already holds promises for every slot from the one it
+// prepared, so it goes straight to the Accept phase with either values recovered in Phase 1 or the head of the
+// queue. In Fast Paxos mode a leader with nothing in flight, no recovered slots and nothing queued opens a fast
+// round for clients instead. Any other proposer starts with Phase 1. The caller must hold p.mu.
+func (p *Proposer) proposeNext() {
+	p.attempts = 0
+	if !p.isLeader {
+		if len(p.pending) > 0 {
+			p.prepare()
+			return
+		}
+		p.stopTimer()
+		p.phase = phaseIdle
+		return
+	}
+	if len(p.inflight) == 0 && !slices.Equal(p.prepared, p.mainAcceptors()) {
+		// A reconfiguration takes effect at this slot, and the new acceptor set has not promised our ballot yet
+		p.prepare()
+		return
+	}
+	if len(p.inflight) == 0 && p.fastMode && len(p.recovered) == 0 {
+		if len(p.pending) == 0 {
+			p.proposeFast()
+			return
+		}
+		if p.anyBallot == p.state.Ballot() {
+			// Acceptors may hold client values under the fast ballot in any slot from here on, so queued values
+			// are proposed in a classic round under a higher ballot, whose Phase 1 recovers those client values
+			p.prepare()
+			return
+		}
+	}
+	p.fillPipeline(true)
+	if len(p.inflight) == 0 && p.phase != phaseBatch {
+		p.stopTimer()
+		p.phase = phaseIdle
+	}
+}
 
-	if p.minProposalNumber > p.proposalNumber {
-		p.proposalNumber = p.minProposalNumber
+// prepare initiates the Prepare phase by sending a Prepare covering the lowest undecided slot and every later one
+// to the quorum. Slots still in flight are abandoned, and Phase 1 recovers whatever was accepted in them. With an
+// empty queue the round only runs Phase 1, which is how a follower takes over from a suspected leader. The caller
+// must hold p.mu.
+func (p *Proposer) prepare() {
+	p.abandonPipeline()
+	// The lease was granted to, and reads were confirmed for, the ballot this round replaces
+	p.dropLease()
+	p.failReads(fmt.Errorf("proposer %v started a new round", p.proposerID))
+	if p.retryPolicy.exhausted(p.attempts) {
+		p.stopTimer()
+		if len(p.pending) == 0 {
+			communication.LogEvent(p.id, "failed", "failed", p.slot, nil, p.state.Ballot())
+			p.phase = phaseIdle
+			return
+		}
+		value := p.nextValue()
+		communication.LogEvent(p.id, "failed", "failed", p.slot, value, p.state.Ballot())
+		p.dequeue(value)
+		p.proposeNext()
+		return
 	}
+	p.attempts++
 
-	if p.acceptedValue != nil {
-		p.value = p.acceptedValue
-		p.acceptedValue = nil
+	// Move to a higher ballot owned by this host. A restarted proposer continues above the ballots it
+	// issued before the crash, and the ballot must be durable before any acceptor can promise it
+	ballot, err := p.state.NextBallot(p.id)
+	if err != nil {
+		fmt.Printf("Failed to persist ballot: %v\n", err)
+		p.backoff()
+		return
 	}
 
-	p.promiseResponses = 0
-	p.proposalNumber += 1 // Increment proposal number
+	p.value = nil
+	if len(p.pending) > 0 {
+		p.value = p.nextValue()
+	}
+	p.recovered = make(map[int64]communication.LogEntry)
+	p.reclaimed = make(map[int64]bool)
+	p.reported = make(map[int64][]communication.LogEntry)
+	p.compacted = 0
+	p.prepared = p.mainAcceptors()
+	p.nextSlot = p.slot
 
-	// Send Prepare message to each acceptor in the quorum
-	p.stateManager.UpdateState(&p.proposalNumber, nil, nil)
+	p.phase = phasePrepare
+	p.resetTimer(p.retryPolicy.PhaseTimeout)
 
-	for _, acceptorID := range p.quorum {
-		if acceptorID == p.id {
-			p.promiseResponses += 1
-		} else {
-			err := p.tcpCommunicator.SendPrepareMessage(acceptorID, p.proposalNumber, p.value)
-			if err != nil {
-				panic(err.Error())
-			}
+	// Send Prepare message to each acceptor in the quorum. A co-located acceptor receives it through the
+	// loopback path and runs the same checks as any other acceptor.
+	for _, acceptorID := range p.acceptors() {
+		err := p.tcpCommunicator.SendPrepareMessage(acceptorID, p.proposerID, p.slot, ballot, p.value)
+		if err != nil {
+			fmt.Printf("Failed to send prepare to peer %v: %v\n", acceptorID, err)
 		}
 	}
 }
 
 func (p *Proposer) Listen() {
+	heartbeatTicker := time.NewTicker(p.leaderPolicy.HeartbeatInterval)
+	defer heartbeatTicker.Stop()
 	for {
 		select {
-		case <-p.sendProposalCh:
-			p.sendProposal()
-		case message := <-p.promiseMessagesCh:
+		case value := <-p.inbox.SendProposalCh:
+			p.sendProposal(value)
+		case message := <-p.inbox.PromiseMessagesCh:
 			p.handlePromiseMessage(message)
-		case message := <-p.acceptedMessagesCh:
+		case message := <-p.inbox.AcceptedMessagesCh:
 			p.handleAcceptedMessage(message)
+		case message := <-p.inbox.NackMessagesCh:
+			p.handleNackMessage(message)
+		case message := <-p.inbox.HeartbeatMessagesCh:
+			p.handleHeartbeatMessage(message)
+		case message := <-p.inbox.ForwardMessagesCh:
+			p.handleForwardMessage(message)
+		case message := <-p.inbox.LeaseMessagesCh:
+			if message.Header.MessageType == communication.CONFIRM_OK {
+				p.handleConfirmOkMessage(message)
+			} else {
+				p.handleLeaseGrantMessage(message)
+			}
+		case request := <-p.inbox.ReadCh:
+			p.handleReadRequest(request)
+		case <-p.timer.C:
+			p.handleTimer()
+		case <-heartbeatTicker.C:
+			p.handleHeartbeatTick()
 		}
 	}
 }
@@ -93,53 +352,210 @@ func (p *Proposer) Listen() {
 func (p *Proposer) handlePromiseMessage(message communication.Message) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.promiseResponses += 1
-	if message.Payload.Proposal > p.minProposalNumber {
-		p.minProposalNumber = message.Payload.Proposal
-	}
-	if message.Payload.Value != nil {
-		p.acceptedValue = message.Payload.Value
-	}
-	p.acceptResponses = 0
-	if p.promiseResponses == int64(len(p.quorum)) {
-		// Ready to send accept message
-		if p.acceptedValue != nil {
-			p.value = p.acceptedValue
-		}
-		p.stateManager.UpdateState(&p.proposalNumber, &p.proposalNumber, &p.value)
-		for _, acceptorID := range p.quorum {
-			if acceptorID == p.id {
-				p.acceptResponses += 1
-			} else {
-				err := p.tcpCommunicator.SendAcceptMessage(acceptorID, p.proposalNumber, p.value)
-				if err != nil {
-					panic(err.Error())
-				}
+
+	p.observeBallot(message.Payload.Ballot)
+	p.observeAcceptor(message.Header.SenderID)
+	// Promises for other slots or older ballots, or arriving after the quorum was reached, are ignored
+	if p.phase != phasePrepare || message.Payload.Slot != p.slot || message.Payload.Ballot != p.state.Ballot() {
+		return
+	}
+
+	promises := p.state.RecordPromise(message.Header.SenderID)
+	p.reported[message.Header.SenderID] = message.Payload.Entries
+	p.compacted = max(p.compacted, message.Payload.Compacted)
+	p.checkPromiseQuorum(promises)
+}
+
+// checkPromiseQuorum moves to the Accept phase once a majority has promised the current ballot.
+func (p *Proposer) checkPromiseQuorum(promises int) {
+	if promises < p.phase1Size() {
+		return
+	}
+	// Every slot below a compaction point was chosen and included in a snapshot, whose values the acceptors no
+	// longer report, so the new leader takes over above it
+	if p.compacted > p.slot {
+		communication.LogEvent(p.id, "skipped", "compact", p.compacted, nil, p.state.Ballot())
+		for slot := range p.chosen {
+			if slot < p.compacted {
+				delete(p.chosen, slot)
 			}
 		}
+		p.slot = p.compacted
+		p.nextSlot = max(p.nextSlot, p.slot)
+	}
+	bySlot := make(map[int64][]communication.LogEntry)
+	for _, entries := range p.reported {
+		for _, entry := range entries {
+			bySlot[entry.Slot] = append(bySlot[entry.Slot], entry)
+		}
+	}
+	for _, slot := range slices.Sorted(maps.Keys(bySlot)) {
+		// Slots chosen while an earlier one was still undecided keep their value
+		if _, done := p.chosen[slot]; done || slot < p.slot {
+			continue
+		}
+		p.recovered[slot] = recoverEntry(bySlot[slot])
+		// Our own commands recovered in some slot are proposed there, so they leave the queue
+		p.reclaimed[slot] = p.dequeue(p.recovered[slot].Value)
+	}
+	p.becomeLeader()
+
+	// Values already accepted in a slot must be proposed again in place of our own, which then moves on to
+	// the next free slot. With nothing to propose the proposer stays idle as leader.
+	p.proposeNext()
+}
+
+// recoverEntry picks the entry of a slot to propose again from those reported in Phase 1: the value reported most
+// often under the highest ballot. A classic ballot carries a single value. A fast ballot may carry several, but a
+// value that a fast quorum may have chosen is always reported more often than any other, because every fast quorum
+// overlaps the promise quorum in more acceptors than the remaining ones.
+func recoverEntry(entries []communication.LogEntry) communication.LogEntry {
+	highest := entries[0].Ballot
+	for _, entry := range entries {
+		if entry.Ballot.GreaterThan(highest) {
+			highest = entry.Ballot
+		}
 	}
+	counts := make(map[interface{}]int)
+	var picked communication.LogEntry
+	for _, entry := range entries {
+		if entry.Ballot != highest {
+			continue
+		}
+		counts[communication.ValueKey(entry.Value)]++
+		if counts[communication.ValueKey(entry.Value)] > counts[communication.ValueKey(picked.Value)] || picked.Ballot.IsZero() {
+			picked = entry
+		}
+	}
+	return picked
+}
 
+// accept sends the value for a slot to the quorum under the ballot promised in Phase 1, and tracks the slot until
+// it is chosen. own reports whether the value was taken off the queue. The caller must hold p.mu.
+func (p *Proposer) accept(slot int64, value interface{}, own bool) {
+	if len(p.inflight) == 0 {
+		p.resetTimer(p.retryPolicy.PhaseTimeout)
+	}
+	p.inflight[slot] = &inflightSlot{value: value, own: own, accepted: make(map[int64]bool)}
+	p.phase = phaseAccept
+	ballot := p.state.Ballot()
+	for _, acceptorID := range p.acceptors() {
+		err := p.tcpCommunicator.SendAcceptMessage(acceptorID, p.proposerID, slot, ballot, value)
+		if err != nil {
+			fmt.Printf("Failed to send accept to peer %v: %v\n", acceptorID, err)
+		}
+	}
 }
 
 // handleAcceptedMessage processes an Accepted message.
 func (p *Proposer) handleAcceptedMessage(message communication.Message) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.acceptResponses += 1
 
-	if message.Payload.Proposal > p.minProposalNumber {
-		p.minProposalNumber = message.Payload.Proposal
+	p.observeBallot(message.Payload.Ballot)
+	p.observeAcceptor(message.Header.SenderID)
+	if p.handleReplicationAccepted(message) {
+		return
+	}
+	if message.Payload.Fast && p.fastMode && p.isLeader && !p.anyBallot.IsZero() && message.Payload.Ballot == p.anyBallot && p.anyBallot == p.state.Ballot() {
+		p.handleFastVote(message)
+		return
+	}
+	// Accepted messages for slots not in flight or older ballots, or arriving after the value was chosen, are ignored
+	entry, ok := p.inflight[message.Payload.Slot]
+	if !ok || message.Payload.Ballot != p.state.Ballot() {
+		return
 	}
-	if message.Payload.Value != p.acceptedValue {
-		p.acceptedValue = message.Payload.Value // helps for the next prepare message incase this is not the final value
+	entry.accepted[message.Header.SenderID] = true
+	p.checkAcceptQuorum(message.Payload.Slot, entry)
+}
+
+// checkAcceptQuorum chooses the value of a slot in flight once a majority has accepted it under the current ballot.
+func (p *Proposer) checkAcceptQuorum(slot int64, entry *inflightSlot) {
+	if len(entry.accepted) < p.phase2Size() {
+		return
 	}
-	if p.acceptResponses == int64(len(p.quorum)) {
-		if p.minProposalNumber <= p.proposalNumber {
-			// Choose the value
-			fmt.Printf("{\"peer_id\": %v, \"action\": \"%v\", \"message_type\":\"%v\", \"message_value\":\"%v\", \"proposal_num\": %v}\n", p.id, "chose", "chose", p.stateManager.GetAcceptedValue(), message.Payload.Proposal)
-		} else {
-			// Send proposal again
-			p.sendProposalCh <- true
+	p.choose(slot, entry.value, entry.accepted)
+}
+
+// choose records the value of a slot as chosen, given the acceptors that accepted it. Slots may be chosen in any
+// order, and deliver reports them in slot order. The caller must hold p.mu.
+func (p *Proposer) choose(slot int64, value interface{}, accepted map[int64]bool) {
+	delete(p.inflight, slot)
+	delete(p.recovered, slot)
+	p.recordUnreplicated(slot, value, accepted)
+	p.chosen[slot] = value
+	p.deliver()
+}
+
+// handleNackMessage aborts the current round as soon as an acceptor reports a promise for a higher ballot.
+func (p *Proposer) handleNackMessage(message communication.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Stepping down abandons the slots in flight, so whether the Nack is for one of them is checked first
+	_, inflight := p.inflight[message.Payload.Slot]
+	p.observeBallot(message.Payload.Ballot)
+	if !inflight && ((p.phase != phasePrepare && p.phase != phaseFast) || message.Payload.Slot != p.slot) {
+		return
+	}
+	// A Nack whose promised ballot does not exceed ours was sent for an earlier round
+	if !message.Payload.Ballot.GreaterThan(p.state.Ballot()) {
+		return
+	}
+	communication.LogEvent(p.id, "aborted", "nack", p.slot, p.headValue(), p.state.Ballot())
+	p.backoff()
+}
+
+// handleTimer abandons a phase that did not reach a quorum in time, or starts the next round once the backoff ends.
+func (p *Proposer) handleTimer() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.phase {
+	case phasePrepare, phaseAccept:
+		communication.LogEvent(p.id, "timeout", "timeout", p.slot, p.headValue(), p.state.Ballot())
+		p.engageAuxiliaries()
+		p.backoff()
+	case phaseFast:
+		// Too few acceptors answered the fast round, so a classic round decides the slots that have votes
+		communication.LogEvent(p.id, "timeout", "timeout", p.slot, nil, p.state.Ballot())
+		p.engageAuxiliaries()
+		p.backoff()
+	case phaseBackoff:
+		p.prepare()
+	case phaseBatch:
+		p.fillPipeline(false)
+		if len(p.inflight) == 0 {
+			p.proposeNext()
+		}
+	}
+}
+
+// backoff abandons the slots in flight and waits a randomized, exponentially growing delay before the next round.
+// The caller must hold p.mu.
+func (p *Proposer) backoff() {
+	p.abandonPipeline()
+	if p.retryPolicy.exhausted(p.attempts) {
+		p.prepare() // Reports the failure
+		return
+	}
+	p.phase = phaseBackoff
+	p.resetTimer(p.retryPolicy.backoff(p.attempts))
+}
+
+// resetTimer stops the timer, discarding a pending expiry, and arms it again with the given duration.
+func (p *Proposer) resetTimer(d time.Duration) {
+	p.stopTimer()
+	p.timer.Reset(d)
+}
+
+// stopTimer stops the timer and discards a pending expiry.
+func (p *Proposer) stopTimer() {
+	if !p.timer.Stop() {
+		select {
+		case <-p.timer.C:
+		default:
 		}
 	}
 }
@@ -0,0 +1,98 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"paxos/communication"
+	"sync"
+)
+
+// ProposerState holds the ballot bookkeeping of a single proposer, kept apart from the acceptor state in
+// StateManager even when both roles run on the same node. With a write-ahead log every ballot is made durable
+// before it is used, so a restarted proposer never reuses a ballot that acceptors may already have promised to it.
+type ProposerState struct {
+	ballot           communication.Ballot // The ballot of the current round, and the highest ballot issued so far
+	maxSeenBallot    communication.Ballot // The highest ballot reported by other nodes
+	promiseResponses map[int64]bool       // Acceptors that promised the current ballot
+	wal              *WriteAheadLog       // Durable log of issued ballots, nil keeps the state in memory only
+	mu               sync.Mutex           // Mutex for thread-safe access to state variables
+}
+
+// NewProposerState initializes and returns a new ProposerState, restoring the highest ballot recorded in the
+// write-ahead log. A nil log keeps the state in memory only.
+func NewProposerState(wal *WriteAheadLog) (*ProposerState, error) {
+	s := &ProposerState{
+		promiseResponses: make(map[int64]bool),
+		wal:              wal,
+	}
+	if wal == nil {
+		return s, nil
+	}
+	err := wal.Replay(func(record communication.Message) {
+		if record.Header.MessageType == walBallotRecord && record.Payload.Ballot.GreaterThan(s.ballot) {
+			s.ballot = record.Payload.Ballot
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay write-ahead log: %v", err)
+	}
+	return s, nil
+}
+
+// Ballot returns the ballot of the current round.
+func (s *ProposerState) Ballot() communication.Ballot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ballot
+}
+
+// MaxSeenBallot returns the highest ballot reported by other nodes.
+func (s *ProposerState) MaxSeenBallot() communication.Ballot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxSeenBallot
+}
+
+// ObserveBallot records a ballot reported by another node and reports whether it outranks the current ballot.
+func (s *ProposerState) ObserveBallot(ballot communication.Ballot) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ballot.GreaterThan(s.maxSeenBallot) {
+		s.maxSeenBallot = ballot
+	}
+	return ballot.GreaterThan(s.ballot)
+}
+
+// NextBallot moves to a ballot owned by the host hostID that is higher than every ballot issued or seen so far, and
+// clears the promises collected for the previous one. The ballot is durable when it returns without error; on
+// error the state is left unchanged and the ballot must not be used.
+func (s *ProposerState) NextBallot(hostID int64) (communication.Ballot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ballot := s.ballot
+	if s.maxSeenBallot.GreaterThan(ballot) {
+		ballot = s.maxSeenBallot
+	}
+	ballot = ballot.Next(hostID)
+
+	if s.wal != nil {
+		record := communication.Message{
+			Header:  communication.MessageHeader{MessageType: walBallotRecord},
+			Payload: communication.PaxosMessage{Ballot: ballot},
+		}
+		if err := s.wal.Append(record); err != nil {
+			return s.ballot, err
+		}
+	}
+	s.ballot = ballot
+	s.promiseResponses = make(map[int64]bool)
+	return ballot, nil
+}
+
+// RecordPromise counts a promise for the current ballot and returns the number of acceptors that promised it.
+func (s *ProposerState) RecordPromise(acceptorID int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.promiseResponses[acceptorID] = true
+	return len(s.promiseResponses)
+}
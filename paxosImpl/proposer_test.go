@@ -0,0 +1,287 @@
+package paxosImpl
+
+import (
+	"maps"
+	"paxos/communication"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestProposer returns the proposer of host 1 in an instance whose acceptors are hosts 1, 2 and 3, together with
+// the state machine its applier feeds. It is connected to nobody, so every message it sends is lost, and the tests
+// play the acceptors and the other proposers by calling its handlers. Timeouts left unset never expire.
+func newTestProposer(config ProposerConfig) (*Proposer, *commandLog) {
+	config.ID, config.ProposerID = 1, 1
+	if config.RetryPolicy.PhaseTimeout == 0 {
+		config.RetryPolicy.PhaseTimeout = time.Hour
+	}
+	if config.LeaderPolicy.ElectionTimeout == 0 {
+		config.LeaderPolicy.ElectionTimeout = time.Hour
+	}
+	membership := NewMembership(1, []int64{1, 2, 3}, int64(max(config.Window, 1)), config.QuorumPolicy, len(config.Auxiliaries), nil)
+	stateMachine := &commandLog{}
+	state, _ := NewProposerState(nil)
+	p := NewProposer(config, membership, NewApplier(1, stateMachine), NewProposerInbox(nil, nil), communication.NewTcpCommunicator(), state)
+	return p, stateMachine
+}
+
+// promiseFrom returns the Promise of an acceptor for the current ballot and slot of the proposer.
+func promiseFrom(p *Proposer, acceptorID int64, entries ...communication.LogEntry) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{SenderID: acceptorID, ProposerID: p.proposerID, MessageType: communication.PROMISE},
+		Payload: communication.PaxosMessage{Slot: p.slot, Ballot: p.state.Ballot(), Entries: entries},
+	}
+}
+
+// acceptedFrom returns the Accepted of an acceptor for a value in a slot under the current ballot of the proposer.
+func acceptedFrom(p *Proposer, acceptorID int64, slot int64, value interface{}) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{SenderID: acceptorID, ProposerID: p.proposerID, MessageType: communication.ACCEPTED},
+		Payload: communication.PaxosMessage{Slot: slot, Ballot: p.state.Ballot(), Value: value},
+	}
+}
+
+// elect runs Phase 1 of the proposer, unless a queued value already started it, and has acceptors 2 and 3 promise
+// with the entries each of them reports.
+func elect(p *Proposer, reported map[int64][]communication.LogEntry) {
+	p.mu.Lock()
+	if p.phase != phasePrepare {
+		p.prepare()
+	}
+	p.mu.Unlock()
+	for _, acceptorID := range []int64{2, 3} {
+		p.handlePromiseMessage(promiseFrom(p, acceptorID, reported[acceptorID]...))
+	}
+}
+
+// acceptInflight has acceptors 2 and 3 accept every slot in flight, as long as slots are in flight, and returns the
+// value the proposer sent in each slot.
+func acceptInflight(p *Proposer) map[int64]interface{} {
+	proposed := make(map[int64]interface{})
+	for {
+		p.mu.Lock()
+		inflight := make(map[int64]interface{})
+		for slot, entry := range p.inflight {
+			inflight[slot] = entry.value
+		}
+		p.mu.Unlock()
+		if len(inflight) == 0 {
+			return proposed
+		}
+		for _, slot := range slices.Sorted(maps.Keys(inflight)) {
+			proposed[slot] = inflight[slot]
+			for _, acceptorID := range []int64{2, 3} {
+				p.handleAcceptedMessage(acceptedFrom(p, acceptorID, slot, inflight[slot]))
+			}
+		}
+	}
+}
+
+func TestMajorityQuorum(t *testing.T) {
+	tests := []struct {
+		name       string
+		promises   []int64 // Acceptors that promise, in order
+		votes      []int64 // Acceptors that accept the queued value, in order
+		wantLeader bool
+		applied    []interface{}
+	}{
+		{
+			name:       "majority of the acceptors",
+			promises:   []int64{2, 3},
+			votes:      []int64{2, 3},
+			wantLeader: true,
+			applied:    []interface{}{"a"},
+		},
+		{
+			name:     "duplicate promise",
+			promises: []int64{2, 2},
+		},
+		{
+			name:       "duplicate vote",
+			promises:   []int64{2, 3},
+			votes:      []int64{3, 3},
+			wantLeader: true,
+		},
+		{
+			name:       "late replies after the quorum",
+			promises:   []int64{2, 3, 1},
+			votes:      []int64{2, 3, 1, 2},
+			wantLeader: true,
+			applied:    []interface{}{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, stateMachine := newTestProposer(ProposerConfig{})
+			p.sendProposal("a")
+			for _, acceptorID := range tt.promises {
+				p.handlePromiseMessage(promiseFrom(p, acceptorID))
+			}
+			if p.isLeader != tt.wantLeader {
+				t.Fatalf("leader %v after promises from %v, want %v", p.isLeader, tt.promises, tt.wantLeader)
+			}
+			if !tt.wantLeader {
+				return
+			}
+			proposed := p.inflight[0].value
+			for _, acceptorID := range tt.votes {
+				p.handleAcceptedMessage(acceptedFrom(p, acceptorID, 0, proposed))
+			}
+			if !reflect.DeepEqual(stateMachine.commands, tt.applied) {
+				t.Errorf("applied %v, want %v", stateMachine.commands, tt.applied)
+			}
+		})
+	}
+}
+
+func TestRangePrepareRecoversAcceptedValues(t *testing.T) {
+	older, newer := communication.Ballot{Round: 1, HostID: 2}, communication.Ballot{Round: 2, HostID: 3}
+	tests := []struct {
+		name     string
+		reported map[int64][]communication.LogEntry
+		ownSlot  int64 // Slot in which acceptor 3 reports our queued command, -1 when none
+		want     map[int64]interface{}
+	}{
+		{
+			name:    "nothing accepted",
+			ownSlot: -1,
+			want:    map[int64]interface{}{0: "a"},
+		},
+		{
+			name: "highest ballot of each slot",
+			reported: map[int64][]communication.LogEntry{
+				2: {{Slot: 0, Ballot: older, Value: "x"}, {Slot: 1, Ballot: older, Value: "y"}},
+				3: {{Slot: 0, Ballot: newer, Value: "z"}},
+			},
+			ownSlot: -1,
+			want:    map[int64]interface{}{0: "z", 1: "y", 2: "a"},
+		},
+		{
+			name:     "own command already accepted",
+			reported: map[int64][]communication.LogEntry{2: {{Slot: 0, Ballot: older, Value: "x"}}},
+			ownSlot:  1,
+			want:     map[int64]interface{}{0: "x", 1: "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProposer(ProposerConfig{})
+			p.state.ObserveBallot(newer)
+			p.sendProposal("a")
+			reported := maps.Clone(tt.reported)
+			if tt.ownSlot >= 0 {
+				reported[3] = append(reported[3], communication.LogEntry{Slot: tt.ownSlot, Ballot: older, Value: p.pending[0]})
+			}
+			elect(p, reported)
+
+			proposed := acceptInflight(p)
+			for slot, value := range proposed {
+				proposed[slot] = communication.CommandValue(value)
+			}
+			if !reflect.DeepEqual(proposed, tt.want) {
+				t.Errorf("proposed %v, want %v", proposed, tt.want)
+			}
+			if len(p.pending) != 0 {
+				t.Errorf("%v values left queued, want none", len(p.pending))
+			}
+		})
+	}
+}
+
+func TestStableLeaderSkipsPhase1(t *testing.T) {
+	p, stateMachine := newTestProposer(ProposerConfig{})
+	p.sendProposal("a")
+	elect(p, nil)
+	acceptInflight(p)
+	ballot := p.state.Ballot()
+
+	p.sendProposal("b")
+	if p.phase != phaseAccept || p.state.Ballot() != ballot {
+		t.Fatalf("phase %v under ballot %v after a second value, want the Accept phase under %v", p.phase, p.state.Ballot(), ballot)
+	}
+	if proposed := acceptInflight(p); len(proposed) != 1 || communication.CommandValue(proposed[1]) != "b" {
+		t.Errorf("proposed %v, want b in slot 1", proposed)
+	}
+	if want := []interface{}{"a", "b"}; !reflect.DeepEqual(stateMachine.commands, want) {
+		t.Errorf("applied %v, want %v", stateMachine.commands, want)
+	}
+}
+
+// nackFrom returns the rejection of an acceptor that promised a ballot for a slot.
+func nackFrom(acceptorID int64, messageType int64, slot int64, promised communication.Ballot) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{SenderID: acceptorID, ProposerID: 1, MessageType: messageType},
+		Payload: communication.PaxosMessage{Slot: slot, Ballot: promised},
+	}
+}
+
+func TestNackAbortsRound(t *testing.T) {
+	tests := []struct {
+		name        string
+		elected     bool // Whether Phase 1 completed before the Nack
+		messageType int64
+		slot        int64
+		promised    communication.Ballot
+		wantPhase   int
+	}{
+		{
+			name:        "higher ballot in Phase 1",
+			messageType: communication.PREPARE_NACK,
+			promised:    communication.Ballot{Round: 5, HostID: 2},
+			wantPhase:   phaseBackoff,
+		},
+		{
+			name:        "stale ballot in Phase 1",
+			messageType: communication.PREPARE_NACK,
+			promised:    communication.Ballot{Round: 0, HostID: 2},
+			wantPhase:   phasePrepare,
+		},
+		{
+			name:        "Phase 1 of another slot",
+			messageType: communication.PREPARE_NACK,
+			slot:        3,
+			promised:    communication.Ballot{Round: 5, HostID: 2},
+			wantPhase:   phasePrepare,
+		},
+		{
+			name:        "higher ballot in Phase 2",
+			elected:     true,
+			messageType: communication.ACCEPT_NACK,
+			promised:    communication.Ballot{Round: 5, HostID: 2},
+			wantPhase:   phaseBackoff,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, stateMachine := newTestProposer(ProposerConfig{})
+			p.sendProposal("a")
+			if tt.elected {
+				elect(p, nil)
+			}
+			p.handleNackMessage(nackFrom(2, tt.messageType, tt.slot, tt.promised))
+			if p.phase != tt.wantPhase {
+				t.Fatalf("phase %v after the Nack, want %v", p.phase, tt.wantPhase)
+			}
+			if tt.wantPhase != phaseBackoff {
+				return
+			}
+			if p.isLeader || len(p.inflight) != 0 || len(p.pending) != 1 {
+				t.Errorf("leader %v with %v slots in flight and %v values queued, want a follower with a queued value",
+					p.isLeader, len(p.inflight), len(p.pending))
+			}
+
+			// The next round runs under a ballot above the one the acceptor reported
+			p.handleTimer()
+			if !p.state.Ballot().GreaterThan(tt.promised) {
+				t.Errorf("retried with ballot %v, not above %v", p.state.Ballot(), tt.promised)
+			}
+			elect(p, nil)
+			acceptInflight(p)
+			if want := []interface{}{"a"}; !reflect.DeepEqual(stateMachine.commands, want) {
+				t.Errorf("applied %v, want %v", stateMachine.commands, want)
+			}
+		})
+	}
+}
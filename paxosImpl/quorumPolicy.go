@@ -0,0 +1,47 @@
+package paxosImpl
+
+import "fmt"
+
+// QuorumPolicy sets how many acceptors each phase waits for, following Flexible Paxos: the Prepare and Accept
+// quorums need not be majorities as long as every Phase 1 quorum intersects every Phase 2 quorum.
+type QuorumPolicy struct {
+	Phase1 int // Acceptors that must promise a ballot, 0 for a majority
+	Phase2 int // Acceptors that must accept a value in a classic round, 0 for a majority
+}
+
+// phase1Size returns the Phase 1 quorum size for n acceptors.
+func (q QuorumPolicy) phase1Size(n int) int {
+	if q.Phase1 == 0 {
+		return majority(n)
+	}
+	return q.Phase1
+}
+
+// phase2Size returns the Phase 2 quorum size of a classic round for n acceptors.
+func (q QuorumPolicy) phase2Size(n int) int {
+	if q.Phase2 == 0 {
+		return majority(n)
+	}
+	return q.Phase2
+}
+
+// fastSize returns the number of acceptors out of n that must accept a value in a fast round. Any two fast
+// quorums and a Phase 1 quorum share an acceptor, which is what lets a classic round recover a fast round.
+func (q QuorumPolicy) fastSize(n int) int {
+	return (2*n-q.phase1Size(n))/2 + 1
+}
+
+// Validate reports an error unless both quorums fit into n acceptors and intersect, Q1 + Q2 > n.
+func (q QuorumPolicy) Validate(n int) error {
+	phase1, phase2 := q.phase1Size(n), q.phase2Size(n)
+	if phase1 < 1 || phase1 > n {
+		return fmt.Errorf("phase 1 quorum of %d does not fit %d acceptors", phase1, n)
+	}
+	if phase2 < 1 || phase2 > n {
+		return fmt.Errorf("phase 2 quorum of %d does not fit %d acceptors", phase2, n)
+	}
+	if phase1+phase2 <= n {
+		return fmt.Errorf("phase 1 quorum of %d and phase 2 quorum of %d do not intersect among %d acceptors", phase1, phase2, n)
+	}
+	return nil
+}
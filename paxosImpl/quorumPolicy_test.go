@@ -0,0 +1,58 @@
+package paxosImpl
+
+import "testing"
+
+func TestQuorumPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  QuorumPolicy
+		n       int
+		wantErr bool
+	}{
+		{name: "majorities", policy: QuorumPolicy{}, n: 3},
+		{name: "majorities of an even set", policy: QuorumPolicy{}, n: 4},
+		{name: "small phase 2", policy: QuorumPolicy{Phase1: 4, Phase2: 2}, n: 5},
+		{name: "small phase 1", policy: QuorumPolicy{Phase1: 1, Phase2: 3}, n: 3},
+		{name: "quorums do not intersect", policy: QuorumPolicy{Phase1: 2, Phase2: 3}, n: 5, wantErr: true},
+		{name: "phase 1 larger than the set", policy: QuorumPolicy{Phase1: 4}, n: 3, wantErr: true},
+		{name: "phase 2 larger than the set", policy: QuorumPolicy{Phase2: 6}, n: 5, wantErr: true},
+		{name: "negative phase 1", policy: QuorumPolicy{Phase1: -1}, n: 3, wantErr: true},
+		{name: "no acceptors", policy: QuorumPolicy{}, n: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%d) = %v, want error %v", tt.n, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQuorumPolicyFastSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy QuorumPolicy
+		n      int
+		want   int
+	}{
+		{name: "three acceptors", policy: QuorumPolicy{}, n: 3, want: 3},
+		{name: "four acceptors", policy: QuorumPolicy{}, n: 4, want: 3},
+		{name: "five acceptors", policy: QuorumPolicy{}, n: 5, want: 4},
+		{name: "seven acceptors", policy: QuorumPolicy{}, n: 7, want: 6},
+		{name: "large phase 1", policy: QuorumPolicy{Phase1: 4, Phase2: 2}, n: 5, want: 4},
+		{name: "small phase 1", policy: QuorumPolicy{Phase1: 2, Phase2: 4}, n: 5, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.fastSize(tt.n)
+			if got != tt.want {
+				t.Errorf("fastSize(%d) = %d, want %d", tt.n, got, tt.want)
+			}
+			// Any two fast quorums and a Phase 1 quorum must share an acceptor
+			if 2*got+tt.policy.phase1Size(tt.n) <= 2*tt.n {
+				t.Errorf("fastSize(%d) = %d lets two fast quorums and a Phase 1 quorum of %d miss each other", tt.n, got, tt.policy.phase1Size(tt.n))
+			}
+		})
+	}
+}
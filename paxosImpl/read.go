@@ -0,0 +1,153 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"paxos/communication"
+)
+
+// ReadRequest asks a proposer for the state of the state machine of the node. Reply must have room for one result,
+// so that the proposer never blocks on it.
+type ReadRequest struct {
+	Reply chan ReadResult
+}
+
+// ReadResult answers a ReadRequest with the last slot applied when the read was served and the state after it.
+// Slot is -1 when nothing was applied yet.
+type ReadResult struct {
+	Slot   int64                // The last slot applied
+	Value  interface{}          // The state of the state machine once Slot was applied, as returned by its Snapshot
+	Ballot communication.Ballot // Ballot of the leader that served the read
+	Lease  bool                 // Whether the read was served under a lease, rather than confirmed with the acceptors
+	Err    error                // Why the read could not be served, nil on success
+}
+
+// pendingRead is a read waiting for the leader's ballot to be confirmed, or for slots to be applied.
+type pendingRead struct {
+	request ReadRequest
+	index   int64 // Every slot below index must be applied before the read is answered
+	lease   bool  // Whether the read relies on the lease
+	confirm int64 // Confirmation round that must be answered first, for reads without a lease
+}
+
+// handleReadRequest serves a read on the leader. Under a lease the leader knows that no other proposer can choose a
+// value, so it answers locally. Without one it records the read index and confirms its ballot with a quorum of
+// acceptors first, the ReadIndex way, which needs no bound on clocks. Either way the read waits until every slot
+// that may have been chosen when it arrived is applied, which covers values accepted but not yet reported to the
+// leader. No log entry is written for a read.
+func (p *Proposer) handleReadRequest(request ReadRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isLeader {
+		request.Reply <- ReadResult{Err: fmt.Errorf("proposer %v does not lead, the known leader is host %v", p.proposerID, p.leaderHost)}
+		return
+	}
+	read := pendingRead{request: request, index: p.readIndex(), lease: p.holdsLease()}
+	if !read.lease {
+		p.requestConfirmation()
+		read.confirm = p.confirmRequest
+	}
+	p.reads = append(p.reads, read)
+	p.serveReads()
+}
+
+// readIndex returns the slot a read must wait for: one above every slot in flight, recovered in Phase 1 or being
+// filled by a fast round. The caller must hold p.mu.
+func (p *Proposer) readIndex() int64 {
+	index := max(p.slot, p.nextSlot)
+	for slot := range p.recovered {
+		index = max(index, slot+1)
+	}
+	for slot := range p.fastVotes {
+		index = max(index, slot+1)
+	}
+	return index
+}
+
+// requestConfirmation starts a confirmation round, which asks the acceptors whether they promised a ballot above
+// the leader's. A round confirms every read that arrived before it was sent. The caller must hold p.mu.
+func (p *Proposer) requestConfirmation() {
+	p.confirmRequest++
+	p.confirmations = make(map[int64]bool)
+	ballot := p.state.Ballot()
+	for _, acceptorID := range p.acceptors() {
+		err := p.tcpCommunicator.SendConfirmMessage(acceptorID, p.proposerID, p.slot, ballot, p.confirmRequest)
+		if err != nil {
+			fmt.Printf("Failed to send confirm to peer %v: %v\n", acceptorID, err)
+		}
+	}
+}
+
+// handleConfirmOkMessage counts a confirmation for the latest round, and serves the reads waiting on it once
+// enough acceptors confirmed the ballot.
+func (p *Proposer) handleConfirmOkMessage(message communication.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isLeader || message.Payload.Request != p.confirmRequest || message.Payload.Ballot != p.state.Ballot() {
+		return
+	}
+	p.confirmations[message.Header.SenderID] = true
+	if len(p.confirmations) < p.leadershipQuorumSize() {
+		return
+	}
+	p.confirmedRequest = p.confirmRequest
+	p.serveReads()
+}
+
+// handleConfirmMessage confirms the sender's ballot, unless a higher ballot was promised. The confirmation changes
+// no state, so nothing is made durable.
+func (a *Acceptor) handleConfirmMessage(message communication.Message) {
+	slot := message.Payload.Slot
+	if !message.Payload.Ballot.AtLeast(a.stateManager.GetMinProposalFrom(slot)) {
+		return
+	}
+	err := a.tcpCommunicator.SendConfirmOkMessage(message.Header.SenderID, message.Header.ProposerID, slot, message.Payload.Ballot, message.Payload.Request)
+	if err != nil {
+		fmt.Printf("Failed to send confirm_ok to peer %v: %v\n", message.Header.SenderID, err)
+	}
+}
+
+// serveReads answers the pending reads that are confirmed and whose slots are all applied, and fails the lease reads
+// once the lease is lost. The caller must hold p.mu.
+func (p *Proposer) serveReads() {
+	waiting := p.reads[:0]
+	for _, read := range p.reads {
+		switch {
+		case read.lease && !p.holdsLease():
+			read.request.Reply <- ReadResult{Err: fmt.Errorf("proposer %v lost its lease", p.proposerID)}
+		case !read.lease && p.confirmedRequest < read.confirm, p.slot < read.index:
+			waiting = append(waiting, read)
+		case p.applier.Applied() < p.slot-1:
+			// A proposer that took over from the slot of its predecessor never saw the values chosen below it, unless
+			// a learner of the host applied them
+			read.request.Reply <- ReadResult{Err: fmt.Errorf("proposer %v has not applied slot %v", p.proposerID, p.slot-1)}
+		default:
+			slot, state := p.applier.State()
+			read.request.Reply <- ReadResult{Slot: slot, Value: state, Ballot: p.state.Ballot(), Lease: read.lease}
+		}
+	}
+	p.reads = waiting
+}
+
+// failReads fails every pending read. The caller must hold p.mu.
+func (p *Proposer) failReads(err error) {
+	for _, read := range p.reads {
+		read.request.Reply <- ReadResult{Err: err}
+	}
+	p.reads = nil
+}
+
+// retryConfirmation starts a new confirmation round while reads wait for one that was not answered, for instance
+// because its messages were lost. The leader calls it on every heartbeat. The caller must hold p.mu.
+func (p *Proposer) retryConfirmation() {
+	if p.confirmedRequest == p.confirmRequest {
+		return
+	}
+	for _, read := range p.reads {
+		if !read.lease && read.confirm > p.confirmedRequest {
+			p.requestConfirmation()
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package paxosImpl
+
+import (
+	"paxos/communication"
+	"testing"
+)
+
+func TestReadIndex(t *testing.T) {
+	tests := []struct {
+		name         string
+		follower     bool // Whether the read reaches a proposer that does not lead
+		queued       []interface{}
+		confirms     []int64 // Acceptors that confirm the ballot
+		staleConfirm bool    // Whether the confirmations carry an older ballot
+		choose       bool    // Whether the slots in flight are chosen after the confirmations
+		wantAnswered bool
+		wantSlot     int64
+		wantErr      bool
+	}{
+		{
+			name:     "read on a follower",
+			follower: true,
+			wantErr:  true,
+		},
+		{
+			name:         "confirmed by a quorum",
+			confirms:     []int64{2, 3},
+			wantAnswered: true,
+			wantSlot:     -1,
+		},
+		{
+			name:     "confirmed by one acceptor",
+			confirms: []int64{2},
+		},
+		{
+			name:         "confirmations for an older ballot",
+			confirms:     []int64{2, 3},
+			staleConfirm: true,
+		},
+		{
+			name:     "slot in flight not chosen yet",
+			queued:   []interface{}{"a"},
+			confirms: []int64{2, 3},
+		},
+		{
+			name:         "slot in flight chosen after the confirmation",
+			queued:       []interface{}{"a"},
+			confirms:     []int64{2, 3},
+			choose:       true,
+			wantAnswered: true,
+			wantSlot:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestProposer(ProposerConfig{})
+			for _, value := range tt.queued {
+				p.sendProposal(value)
+			}
+			if !tt.follower {
+				elect(p, nil)
+			}
+
+			reply := make(chan ReadResult, 1)
+			p.handleReadRequest(ReadRequest{Reply: reply})
+			ballot := p.state.Ballot()
+			if tt.staleConfirm {
+				ballot = communication.Ballot{Round: ballot.Round - 1, HostID: ballot.HostID}
+			}
+			for _, acceptorID := range tt.confirms {
+				p.handleConfirmOkMessage(ballotMessage(acceptorID, communication.CONFIRM_OK, ballot, p.confirmRequest))
+			}
+			if tt.choose {
+				acceptInflight(p)
+			}
+			select {
+			case result := <-reply:
+				if tt.wantErr {
+					if result.Err == nil {
+						t.Errorf("read answered with %+v, want an error", result)
+					}
+					return
+				}
+				if !tt.wantAnswered || result.Err != nil || result.Lease || result.Slot != tt.wantSlot {
+					t.Errorf("read answered with %+v, want a confirmed read of slot %v answered %v", result, tt.wantSlot, tt.wantAnswered)
+				}
+			default:
+				if tt.wantAnswered || tt.wantErr {
+					t.Errorf("read not answered, want it answered")
+				}
+			}
+		})
+	}
+}
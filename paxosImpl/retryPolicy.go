@@ -0,0 +1,36 @@
+package paxosImpl
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how long a Proposer waits for each phase and how it backs off between rounds.
+type RetryPolicy struct {
+	PhaseTimeout time.Duration // How long to wait for a quorum in the Prepare or Accept phase
+	BackoffBase  time.Duration // Upper bound of the backoff before the first retry
+	BackoffMax   time.Duration // Cap on the exponentially growing backoff
+	MaxAttempts  int           // Rounds to try before reporting failure, 0 retries forever
+}
+
+// backoff returns a randomized delay before the given retry attempt. The upper bound doubles with
+// every attempt up to BackoffMax, and the delay is drawn uniformly below it so that dueling
+// proposers are unlikely to collide again.
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	limit := r.BackoffBase
+	for i := 1; i < attempt && limit < r.BackoffMax; i++ {
+		limit *= 2
+	}
+	if limit > r.BackoffMax {
+		limit = r.BackoffMax
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// exhausted reports whether no further rounds may be started after the given number of attempts.
+func (r RetryPolicy) exhausted(attempts int) bool {
+	return r.MaxAttempts > 0 && attempts >= r.MaxAttempts
+}
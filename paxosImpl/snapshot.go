@@ -0,0 +1,120 @@
+package paxosImpl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"paxos/communication"
+	"sync"
+)
+
+// checksumSize is the size of the CRC-32 checksum that precedes the encoded snapshot in a snapshot file.
+const checksumSize = 4
+
+// Snapshot is the application state once every slot up to and including LastSlot was applied. It also carries
+// the reconfigurations chosen in those slots, since the acceptor sets of later slots depend on them.
+type Snapshot struct {
+	LastSlot         int64                    // The last slot included in the snapshot
+	State            interface{}              // The application state after LastSlot was applied
+	Reconfigurations []communication.LogEntry // Reconfigurations chosen up to LastSlot, with the slot they were chosen in
+}
+
+// payload encodes the snapshot in the fields of a Compact message.
+func (s Snapshot) payload() communication.PaxosMessage {
+	return communication.PaxosMessage{Slot: s.LastSlot, Value: s.State, Entries: s.Reconfigurations}
+}
+
+// snapshotFromPayload decodes a snapshot from the fields of a Compact message.
+func snapshotFromPayload(payload communication.PaxosMessage) Snapshot {
+	return Snapshot{LastSlot: payload.Slot, State: payload.Value, Reconfigurations: payload.Entries}
+}
+
+// SnapshotStore keeps the latest snapshot of one role of an instance in a file next to its write-ahead log. The file
+// holds a CRC-32 checksum followed by the snapshot in the framing of the wire codec, and is replaced atomically.
+type SnapshotStore struct {
+	path string     // Location of the snapshot file
+	mu   sync.Mutex // Mutex serializing saves and loads
+}
+
+// NewSnapshotStore returns a store for the snapshot file at path, creating its directory.
+func NewSnapshotStore(path string) (*SnapshotStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %v", err)
+	}
+	return &SnapshotStore{path: path}, nil
+}
+
+// Save durably replaces the stored snapshot. The snapshot is written to a temporary file that is renamed over the
+// previous one, so a crash leaves either the old snapshot or the new one.
+func (s *SnapshotStore) Save(snapshot Snapshot) error {
+	encoded, err := communication.ConvertToBinary(communication.Message{
+		Header:  communication.MessageHeader{MessageType: communication.COMPACT},
+		Payload: snapshot.payload(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %v", err)
+	}
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, checksumSize+len(encoded)), crc32.ChecksumIEEE(encoded))
+	buf = append(buf, encoded...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return replaceFile(s.path, buf)
+}
+
+// Load returns the stored snapshot, and false when none was saved yet. A snapshot whose checksum does not match is
+// reported as an error.
+func (s *SnapshotStore) Load() (Snapshot, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, false, nil
+	}
+	if err != nil {
+		return Snapshot{}, false, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+	if len(buf) < checksumSize || binary.BigEndian.Uint32(buf) != crc32.ChecksumIEEE(buf[checksumSize:]) {
+		return Snapshot{}, false, fmt.Errorf("snapshot %v is corrupt: checksum mismatch", s.path)
+	}
+	message, err := communication.ReadMessage(bytes.NewReader(buf[checksumSize:]))
+	if err != nil {
+		return Snapshot{}, false, fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+	return snapshotFromPayload(message.Payload), true, nil
+}
+
+// replaceFile durably replaces the file at path with data, through a temporary file renamed over it.
+func replaceFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %v: %v", tmp, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %v: %v", tmp, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync %v: %v", tmp, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close %v: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace %v: %v", path, err)
+	}
+	// The rename itself is durable once the directory is synced
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to open data directory: %v", err)
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
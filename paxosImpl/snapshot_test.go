@@ -0,0 +1,75 @@
+package paxosImpl
+
+import (
+	"os"
+	"path/filepath"
+	"paxos/communication"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotStoreChecksum(t *testing.T) {
+	snapshot := Snapshot{
+		LastSlot:         41,
+		State:            "x=1",
+		Reconfigurations: []communication.LogEntry{{Slot: 3, Value: "reconfigure:add:4"}},
+	}
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte // Damage done to the saved file, nil to leave it intact
+		wantErr bool
+	}{
+		{name: "intact", corrupt: nil},
+		{name: "flipped checksum byte", corrupt: func(data []byte) []byte { data[0] ^= 0xff; return data }, wantErr: true},
+		{name: "flipped header byte", corrupt: func(data []byte) []byte { data[checksumSize+8] ^= 0x01; return data }, wantErr: true},
+		{name: "flipped payload byte", corrupt: func(data []byte) []byte { data[len(data)-1] ^= 0x01; return data }, wantErr: true},
+		{name: "truncated payload", corrupt: func(data []byte) []byte { return data[:len(data)-1] }, wantErr: true},
+		{name: "shorter than the checksum", corrupt: func(data []byte) []byte { return data[:checksumSize-1] }, wantErr: true},
+		{name: "empty", corrupt: func(data []byte) []byte { return data[:0] }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.snapshot")
+			store, err := NewSnapshotStore(path)
+			if err != nil {
+				t.Fatalf("NewSnapshotStore: %v", err)
+			}
+			if err := store.Save(snapshot); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if tt.corrupt != nil {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("reading snapshot: %v", err)
+				}
+				if err := os.WriteFile(path, tt.corrupt(data), 0o644); err != nil {
+					t.Fatalf("writing snapshot: %v", err)
+				}
+			}
+
+			got, found, err := store.Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Load() = %+v, %v, want an error", got, found)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !found || !reflect.DeepEqual(got, snapshot) {
+				t.Errorf("Load() = %+v, %v, want %+v, true", got, found, snapshot)
+			}
+		})
+	}
+}
+
+func TestSnapshotStoreMissing(t *testing.T) {
+	store, err := NewSnapshotStore(filepath.Join(t.TempDir(), "data", "test.snapshot"))
+	if err != nil {
+		t.Fatalf("NewSnapshotStore: %v", err)
+	}
+	if got, found, err := store.Load(); err != nil || found {
+		t.Errorf("Load() = %+v, %v, %v, want no snapshot and no error", got, found, err)
+	}
+}
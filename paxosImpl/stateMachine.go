@@ -0,0 +1,79 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// StateMachine is the deterministic application the replicated log drives. Each node runs one per instance, and its
+// Applier applies every chosen command to it exactly once, in slot order, whether the leader or the learner of the
+// node learned it first. The Learner saves its state in snapshots, and the leader answers reads from it. Two state
+// machines that applied the same commands must hold the same state, so Apply may not depend on anything but its
+// arguments and the state.
+type StateMachine interface {
+	// Apply executes a command chosen in a slot and returns its result. The commands of a batch are applied one by
+	// one with the slot of the batch. Reconfigurations are not passed to the state machine.
+	Apply(slot int64, command interface{}) interface{}
+	// Snapshot returns the current state, in a form the wire codec can encode.
+	Snapshot() interface{}
+	// Restore replaces the state with one returned by Snapshot, and fails if it cannot be read.
+	Restore(state interface{}) error
+}
+
+// stateMachines holds the constructor of every state machine a node can run, by the name -state-machine selects it
+// with.
+var stateMachines = map[string]func() StateMachine{
+	"register": func() StateMachine { return NewRegister() },
+}
+
+// RegisterStateMachine makes a state machine available to the node under a name. Applications call it from an init
+// function, before the node starts, to plug in their own deterministic logic; a name registered again is replaced.
+func RegisterStateMachine(name string, newStateMachine func() StateMachine) {
+	stateMachines[name] = newStateMachine
+}
+
+// LookupStateMachine returns the constructor of the state machine registered under name.
+func LookupStateMachine(name string) (func() StateMachine, error) {
+	newStateMachine, ok := stateMachines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown state machine %q, registered are %v", name, slices.Sorted(maps.Keys(stateMachines)))
+	}
+	return newStateMachine, nil
+}
+
+// Register is the default state machine: a single register that every command overwrites. Apply returns the new
+// value, and the state is the last command applied, nil before any.
+type Register struct {
+	value interface{}
+	mu    sync.RWMutex
+}
+
+// NewRegister returns an empty register.
+func NewRegister() *Register {
+	return &Register{}
+}
+
+// Apply stores the command as the value of the register.
+func (r *Register) Apply(slot int64, command interface{}) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.value = command
+	return command
+}
+
+// Snapshot returns the value of the register.
+func (r *Register) Snapshot() interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.value
+}
+
+// Restore sets the value of the register.
+func (r *Register) Restore(state interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.value = state
+	return nil
+}
@@ -1,67 +1,257 @@
 package paxosImpl
 
 import (
+	"fmt"
+	"maps"
+	"math"
+	"paxos/communication"
+	"slices"
+	"sort"
 	"sync"
 )
 
-// StateManager manages the state of the Paxos acceptor.
+// InstanceState is the acceptor state of a single slot of the replicated log.
+type InstanceState struct {
+	MinProposal      communication.Ballot // The highest ballot seen so far for the slot.
+	AcceptedProposal communication.Ballot // The ballot that has been accepted for the slot.
+	AcceptedValue    interface{}          // The value associated with the accepted proposal.
+	AcceptedFast     bool                 // Whether the value was accepted from a client in a fast round.
+}
+
+// StateManager manages the per-slot state of the Paxos acceptor. When it has a write-ahead log, every change
+// is made durable before the in-memory state is updated, so replies sent afterwards never outlive a crash.
 type StateManager struct {
-	minProposal      int64        // The highest proposal number seen so far.
-	acceptedProposal int64        // The proposal number that has been accepted.
-	acceptedValue    interface{}  // The value associated with the accepted proposal.
-	mu               sync.RWMutex // Mutex for thread-safe access to state variables.
+	instances    map[int64]*InstanceState // Acceptor state indexed by slot.
+	wal          *WriteAheadLog           // Durable log of state changes, nil keeps the state in memory only.
+	rangePromise communication.Ballot     // Ballot promised for every slot at or above promisedFrom.
+	promisedFrom int64                    // First slot covered by rangePromise.
+	discarded    int64                    // Slot below which the state of every slot was discarded.
+	mu           sync.RWMutex             // Mutex for thread-safe access to state variables.
 }
 
-// NewStateManager initializes and returns a new StateManager instance.
-func NewStateManager() *StateManager {
-	return &StateManager{
-		minProposal:      0,
-		acceptedProposal: 0,
-		acceptedValue:    nil,
+// NewStateManager initializes and returns a new StateManager instance, restoring the state recorded in the
+// write-ahead log. A nil log keeps the state in memory only.
+func NewStateManager(wal *WriteAheadLog) (*StateManager, error) {
+	s := &StateManager{
+		instances:    make(map[int64]*InstanceState),
+		wal:          wal,
+		rangePromise: communication.Ballot{},
+		promisedFrom: math.MaxInt64,
+	}
+	if wal == nil {
+		return s, nil
 	}
+	err := wal.Replay(func(record communication.Message) {
+		switch record.Header.MessageType {
+		case walInstanceRecord:
+			if record.Payload.Slot < s.discarded {
+				break
+			}
+			instance := &InstanceState{MinProposal: record.Payload.Ballot}
+			if len(record.Payload.Entries) == 1 {
+				instance.AcceptedProposal = record.Payload.Entries[0].Ballot
+				instance.AcceptedValue = record.Payload.Entries[0].Value
+				instance.AcceptedFast = record.Payload.Entries[0].Fast
+			}
+			s.instances[record.Payload.Slot] = instance
+		case walPromiseRecord:
+			s.rangePromise = record.Payload.Ballot
+			s.promisedFrom = record.Payload.Slot
+		case walDiscardRecord:
+			s.discardBelow(record.Payload.Slot)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay write-ahead log: %v", err)
+	}
+	return s, nil
 }
 
-// UpdateState allows updating any of the state variables
-func (s *StateManager) UpdateState(minProposal *int64, acceptedProposal *int64, acceptedValue *interface{}) {
+// UpdateState allows updating any of the state variables of a slot. The change is durable when it returns
+// without error; on error the state is left unchanged.
+func (s *StateManager) UpdateState(slot int64, minProposal *communication.Ballot, acceptedProposal *communication.Ballot, acceptedValue *interface{},
+	acceptedFast *bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	instance := InstanceState{}
+	if current, exists := s.instances[slot]; exists {
+		instance = *current
+	}
 	if minProposal != nil {
-		s.minProposal = *minProposal
+		instance.MinProposal = *minProposal
 	}
 	if acceptedProposal != nil {
-		s.acceptedProposal = *acceptedProposal
+		instance.AcceptedProposal = *acceptedProposal
 	}
 	if acceptedValue != nil {
-		s.acceptedValue = *acceptedValue
+		instance.AcceptedValue = *acceptedValue
+	}
+	if acceptedFast != nil {
+		instance.AcceptedFast = *acceptedFast
 	}
+
+	if s.wal != nil {
+		if err := s.wal.Append(instanceRecord(slot, &instance)); err != nil {
+			return err
+		}
+	}
+	s.instances[slot] = &instance
+	return nil
 }
 
-// GetState returns the current state values in a thread-safe manner.
-func (s *StateManager) GetState() (int64, int64, interface{}) {
+// UpdatePromise promises a ballot for every slot at or above fromSlot. Slots covered by an earlier range
+// promise stay covered, which only makes the acceptor more conservative. The promise is durable when it
+// returns without error; on error the state is left unchanged.
+func (s *StateManager) UpdatePromise(fromSlot int64, ballot communication.Ballot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	promisedFrom := s.promisedFrom
+	if fromSlot < promisedFrom {
+		promisedFrom = fromSlot
+	}
+	if s.wal != nil {
+		if err := s.appendRecord(walPromiseRecord, communication.PaxosMessage{Slot: promisedFrom, Ballot: ballot}); err != nil {
+			return err
+		}
+	}
+	s.rangePromise = ballot
+	s.promisedFrom = promisedFrom
+	return nil
+}
+
+// Discard drops the state of every slot below the given one. The range promise is kept. The write-ahead log is
+// rewritten with the state that remains, so it no longer grows with every slot ever accepted. The change is durable
+// when it returns without error; on error the state is left unchanged.
+func (s *StateManager) Discard(below int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if below <= s.discarded {
+		return nil
+	}
+	if s.wal != nil {
+		records := []communication.Message{walRecord(walDiscardRecord, communication.PaxosMessage{Slot: below})}
+		if s.promisedFrom != math.MaxInt64 {
+			records = append(records, walRecord(walPromiseRecord, communication.PaxosMessage{Slot: s.promisedFrom, Ballot: s.rangePromise}))
+		}
+		for _, slot := range slices.Sorted(maps.Keys(s.instances)) {
+			if slot >= below {
+				records = append(records, instanceRecord(slot, s.instances[slot]))
+			}
+		}
+		if err := s.wal.Rewrite(records); err != nil {
+			return err
+		}
+	}
+	s.discardBelow(below)
+	return nil
+}
+
+// discardBelow drops the state of every slot below the given one. The caller must hold s.mu.
+func (s *StateManager) discardBelow(below int64) {
+	for slot := range s.instances {
+		if slot < below {
+			delete(s.instances, slot)
+		}
+	}
+	s.discarded = max(s.discarded, below)
+}
+
+// DiscardedBelow returns the slot below which the state of every slot was discarded, 0 when none was.
+func (s *StateManager) DiscardedBelow() int64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.discarded
+}
 
-	return s.minProposal, s.acceptedProposal, s.acceptedValue
+// appendRecord writes a state change to the write-ahead log. The caller must hold s.mu.
+func (s *StateManager) appendRecord(kind int64, payload communication.PaxosMessage) error {
+	return s.wal.Append(walRecord(kind, payload))
+}
+
+// walRecord frames a state change as a write-ahead log record of the given kind.
+func walRecord(kind int64, payload communication.PaxosMessage) communication.Message {
+	return communication.Message{
+		Header:  communication.MessageHeader{MessageType: kind},
+		Payload: payload,
+	}
 }
 
-// GetMinProposal returns the current minProposal value.
-func (s *StateManager) GetMinProposal() int64 {
+// instanceRecord returns the write-ahead log record holding the full state of one slot.
+func instanceRecord(slot int64, instance *InstanceState) communication.Message {
+	return walRecord(walInstanceRecord, communication.PaxosMessage{
+		Slot:    slot,
+		Ballot:  instance.MinProposal,
+		Entries: []communication.LogEntry{{Slot: slot, Ballot: instance.AcceptedProposal, Value: instance.AcceptedValue, Fast: instance.AcceptedFast}},
+	})
+}
+
+// GetState returns the current state values of a slot in a thread-safe manner. The min proposal accounts
+// for a range promise covering the slot.
+func (s *StateManager) GetState(slot int64) (communication.Ballot, communication.Ballot, interface{}) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.minProposal
+
+	minProposal := communication.Ballot{}
+	if slot >= s.promisedFrom {
+		minProposal = s.rangePromise
+	}
+	instance, exists := s.instances[slot]
+	if !exists {
+		return minProposal, communication.Ballot{}, nil
+	}
+	if instance.MinProposal.GreaterThan(minProposal) {
+		minProposal = instance.MinProposal
+	}
+	return minProposal, instance.AcceptedProposal, instance.AcceptedValue
 }
 
-// GetAcceptedProposal returns the current acceptedProposal value.
-func (s *StateManager) GetAcceptedProposal() int64 {
+// GetMinProposalFrom returns the highest ballot promised for any slot at or above fromSlot.
+func (s *StateManager) GetMinProposalFrom(fromSlot int64) communication.Ballot {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.acceptedProposal
+
+	minProposal := s.rangePromise
+	for slot, instance := range s.instances {
+		if slot >= fromSlot && instance.MinProposal.GreaterThan(minProposal) {
+			minProposal = instance.MinProposal
+		}
+	}
+	return minProposal
 }
 
-// GetAcceptedValue returns the current acceptedValue.
-func (s *StateManager) GetAcceptedValue() interface{} {
+// GetAcceptedFrom returns the accepted entries of every slot at or above fromSlot, ordered by slot.
+func (s *StateManager) GetAcceptedFrom(fromSlot int64) []communication.LogEntry {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.acceptedValue
+
+	entries := []communication.LogEntry{}
+	for slot, instance := range s.instances {
+		if slot >= fromSlot && instance.AcceptedValue != nil {
+			entries = append(entries, communication.LogEntry{Slot: slot, Ballot: instance.AcceptedProposal, Value: instance.AcceptedValue,
+				Fast: instance.AcceptedFast})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Slot < entries[j].Slot })
+	return entries
+}
+
+// GetMinProposal returns the current minProposal value of a slot.
+func (s *StateManager) GetMinProposal(slot int64) communication.Ballot {
+	minProposal, _, _ := s.GetState(slot)
+	return minProposal
+}
+
+// GetAcceptedProposal returns the current acceptedProposal value of a slot.
+func (s *StateManager) GetAcceptedProposal(slot int64) communication.Ballot {
+	_, acceptedProposal, _ := s.GetState(slot)
+	return acceptedProposal
+}
+
+// GetAcceptedValue returns the current acceptedValue of a slot.
+func (s *StateManager) GetAcceptedValue(slot int64) interface{} {
+	_, _, acceptedValue := s.GetState(slot)
+	return acceptedValue
 }
@@ -0,0 +1,118 @@
+package paxosImpl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"paxos/communication"
+	"sync"
+)
+
+// Kinds of write-ahead log records. Records reuse the framing of the wire codec, with the record kind stored
+// as the message type.
+const (
+	walInstanceRecord = 1 // Full state of one slot: Slot, Ballot as MinProposal and a single accepted entry
+	walPromiseRecord  = 2 // Range promise: Slot as promisedFrom and Ballot as rangePromise
+	walBallotRecord   = 3 // Ballot issued by a proposer
+	walDiscardRecord  = 4 // Slot below which the state of every slot was discarded
+)
+
+// WriteAheadLog durably records state changes so that promises and issued ballots survive a restart.
+type WriteAheadLog struct {
+	path string     // Location of the log file
+	file *os.File   // Log file opened for appending
+	mu   sync.Mutex // Mutex serializing appends
+}
+
+// OpenWriteAheadLog opens, or creates, the log file at path along with its directory.
+func OpenWriteAheadLog(path string) (*WriteAheadLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log: %v", err)
+	}
+	return &WriteAheadLog{path: path, file: file}, nil
+}
+
+// Append writes a record and fsyncs it, so the change is durable once Append returns.
+func (w *WriteAheadLog) Append(record communication.Message) error {
+	buf, err := communication.ConvertToBinary(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode write-ahead log record: %v", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.file.Write(buf); err != nil {
+		return fmt.Errorf("failed to write write-ahead log record: %v", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %v", err)
+	}
+	return nil
+}
+
+// Replay calls apply for every record in the log, in the order they were written. A record torn by a crash
+// in the middle of a write is discarded by truncating the log after the last complete record.
+func (w *WriteAheadLog) Replay(apply func(record communication.Message)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	reader, err := os.Open(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to open write-ahead log for replay: %v", err)
+	}
+	defer reader.Close()
+
+	info, err := reader.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat write-ahead log: %v", err)
+	}
+	var offset int64
+	for offset < info.Size() {
+		record, err := communication.ReadMessage(reader)
+		if err != nil {
+			fmt.Printf("Discarding torn write-ahead log tail at offset %v: %v\n", offset, err)
+			return w.file.Truncate(offset)
+		}
+		offset += communication.HeaderSize + record.Header.PayloadSize
+		apply(record)
+	}
+	return nil
+}
+
+// Rewrite durably replaces the whole log with the given records, which must describe the same state as the records
+// they replace. The log is written to a temporary file that is renamed over it, so a crash leaves either log.
+func (w *WriteAheadLog) Rewrite(records []communication.Message) error {
+	buf := []byte{}
+	for _, record := range records {
+		encoded, err := communication.ConvertToBinary(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode write-ahead log record: %v", err)
+		}
+		buf = append(buf, encoded...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := replaceFile(w.path, buf); err != nil {
+		return fmt.Errorf("failed to rewrite write-ahead log: %v", err)
+	}
+	// The open file still refers to the log that was replaced
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen write-ahead log: %v", err)
+	}
+	w.file.Close()
+	w.file = file
+	return nil
+}
+
+// Close closes the log file.
+func (w *WriteAheadLog) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
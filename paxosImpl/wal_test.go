@@ -0,0 +1,132 @@
+package paxosImpl
+
+import (
+	"os"
+	"path/filepath"
+	"paxos/communication"
+	"reflect"
+	"testing"
+)
+
+// ballotRecords returns one ballot record per round, in order.
+func ballotRecords(rounds ...int64) []communication.Message {
+	records := []communication.Message{}
+	for _, round := range rounds {
+		records = append(records, walRecord(walBallotRecord, communication.PaxosMessage{Ballot: communication.Ballot{Round: round, HostID: 1}}))
+	}
+	return records
+}
+
+// replayRounds replays the log and returns the rounds of the ballot records it replays.
+func replayRounds(t *testing.T, wal *WriteAheadLog) []int64 {
+	t.Helper()
+	rounds := []int64{}
+	err := wal.Replay(func(record communication.Message) {
+		rounds = append(rounds, record.Payload.Ballot.Round)
+	})
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	return rounds
+}
+
+func TestWriteAheadLogTornTail(t *testing.T) {
+	complete, err := communication.ConvertToBinary(ballotRecords(3)[0])
+	if err != nil {
+		t.Fatalf("ConvertToBinary: %v", err)
+	}
+	tests := []struct {
+		name string
+		tail []byte
+		want []int64
+	}{
+		{name: "no tail", tail: nil, want: []int64{1, 2}},
+		{name: "partial header", tail: complete[:communication.HeaderSize/2], want: []int64{1, 2}},
+		{name: "header only", tail: complete[:communication.HeaderSize], want: []int64{1, 2}},
+		{name: "partial payload", tail: complete[:len(complete)-1], want: []int64{1, 2}},
+		{name: "complete record", tail: complete, want: []int64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			wal, err := OpenWriteAheadLog(path)
+			if err != nil {
+				t.Fatalf("OpenWriteAheadLog: %v", err)
+			}
+			defer wal.Close()
+			for _, record := range ballotRecords(1, 2) {
+				if err := wal.Append(record); err != nil {
+					t.Fatalf("Append: %v", err)
+				}
+			}
+			// A crash in the middle of an append leaves a prefix of the record behind
+			if _, err := wal.file.Write(tt.tail); err != nil {
+				t.Fatalf("writing tail: %v", err)
+			}
+
+			if got := replayRounds(t, wal); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed rounds %v, want %v", got, tt.want)
+			}
+			// Records appended after the torn tail was discarded are replayed after the complete ones
+			if err := wal.Append(ballotRecords(4)[0]); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+			want := append(tt.want, 4)
+			if got := replayRounds(t, wal); !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed rounds after append %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteAheadLogRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   []int64
+		rewrite  []int64
+		appended []int64
+		want     []int64
+	}{
+		{name: "shrink", before: []int64{1, 2, 3, 4}, rewrite: []int64{4}, appended: []int64{5}, want: []int64{4, 5}},
+		{name: "empty", before: []int64{1, 2}, rewrite: nil, appended: []int64{3}, want: []int64{3}},
+		{name: "nothing appended", before: []int64{1}, rewrite: []int64{1, 2}, appended: nil, want: []int64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.wal")
+			wal, err := OpenWriteAheadLog(path)
+			if err != nil {
+				t.Fatalf("OpenWriteAheadLog: %v", err)
+			}
+			for _, record := range ballotRecords(tt.before...) {
+				if err := wal.Append(record); err != nil {
+					t.Fatalf("Append: %v", err)
+				}
+			}
+			if err := wal.Rewrite(ballotRecords(tt.rewrite...)); err != nil {
+				t.Fatalf("Rewrite: %v", err)
+			}
+			for _, record := range ballotRecords(tt.appended...) {
+				if err := wal.Append(record); err != nil {
+					t.Fatalf("Append after Rewrite: %v", err)
+				}
+			}
+			if err := wal.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("temporary file left behind: %v", err)
+			}
+
+			// The rewritten log is what a restarted node replays
+			reopened, err := OpenWriteAheadLog(path)
+			if err != nil {
+				t.Fatalf("OpenWriteAheadLog: %v", err)
+			}
+			defer reopened.Close()
+			if got := replayRounds(t, reopened); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replayed rounds %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
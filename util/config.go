@@ -3,38 +3,157 @@ package util
 import (
 	"bufio"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+)
+
+// Consensus protocols selectable with -mode. Every node of a cluster must run the same mode.
+const (
+	ClassicMode = "classic"
+	FastMode    = "fast"
+	EPaxosMode  = "epaxos"
 )
 
 const (
 	ProposerRole = "proposer"
 	AcceptorRole = "acceptor"
 	LearnerRole  = "learner"
+	// Auxiliary acceptors of Cheap Paxos only take part while a main acceptor of their instance is unreachable
+	AuxiliaryRole = "auxiliary"
 )
 
 type HostInfo struct {
-	Hostname string
-	Proposer []int64
-	Acceptor []int64
-	Learner  []int64
+	Hostname  string
+	Proposer  []int64
+	Acceptor  []int64
+	Learner   []int64
+	Auxiliary []int64
 }
 
-func ParseFlags() (string, string, float64) {
+// Config holds the command-line configuration of a node.
+type Config struct {
+	Hostfile       string        // Path to the hostfile
+	ProposerValue  string        // Value proposed by the proposers on this host
+	TimeDelay      float64       // Seconds to wait before sending a proposal
+	ReadDelay      float64       // Seconds to wait before reading the latest decided value, negative for no read
+	PhaseTimeout   time.Duration // How long a proposer waits for a quorum in each phase
+	BackoffBase    time.Duration // Initial upper bound of the randomized backoff between rounds
+	BackoffMax     time.Duration // Cap on the exponentially growing backoff
+	MaxAttempts    int           // Rounds a proposer tries before reporting failure, 0 for no limit
+	Heartbeat      time.Duration // How often the leader sends heartbeats
+	Election       time.Duration // How long followers wait for a heartbeat before taking over
+	DataDir        string        // Directory holding the write-ahead logs and snapshots, empty to keep state in memory
+	ConnectTimeout time.Duration // How long startup waits for peers before going ahead without them
+	Mode           string        // Consensus protocol run by the cluster, ClassicMode, FastMode or EPaxosMode
+	Phase1Quorum   int           // Acceptors that must promise a ballot, 0 for a majority
+	Phase2Quorum   int           // Acceptors that must accept a value, 0 for a majority
+	ReconfigDelay  int64         // Slots between a reconfiguration entry and the slot it takes effect at
+	BatchWindow    time.Duration // How long the leader waits for more commands before proposing a batch
+	BatchSize      int           // Most commands the leader proposes together in one slot
+	PipelineWindow int           // Most slots the leader keeps in the Accept phase at once
+	LeaseDuration  time.Duration // How long acceptors refuse other proposers after granting the leader a lease, 0 for no leases
+	LeaseDrift     time.Duration // Bound on how far clocks drift apart over one lease duration
+	SnapshotSlots  int64         // Slots a learner applies between two snapshots, 0 for no snapshots
+	CatchUp        time.Duration // How often a learner checks whether it missed slots
+	StateMachine   string        // Name of the state machine each instance applies chosen commands to
+}
+
+func ParseFlags() Config {
 	hostfile := flag.String("h", "", "Path to the hostfile")
 	proposerValue := flag.String("v", "", "Proposer value")
 	timeDelay := flag.Float64("t", 0.0, "Time delay in seconds to wait before sending a proposal")
+	readDelay := flag.Float64("r", -1, "Time delay in seconds to wait before reading the latest decided value, negative for no read")
+	phaseTimeout := flag.Duration("phase-timeout", 2*time.Second, "Time to wait for a quorum in the Prepare or Accept phase")
+	backoffBase := flag.Duration("backoff-base", 100*time.Millisecond, "Initial upper bound of the randomized backoff between rounds")
+	backoffMax := flag.Duration("backoff-max", 5*time.Second, "Maximum backoff between rounds")
+	maxAttempts := flag.Int("max-attempts", 10, "Number of rounds to try before reporting failure, 0 for no limit")
+	heartbeat := flag.Duration("heartbeat", 500*time.Millisecond, "Interval between leader heartbeats")
+	election := flag.Duration("election-timeout", 2*time.Second, "Time without a heartbeat after which followers suspect the leader")
+	dataDir := flag.String("data-dir", "", "Directory for the write-ahead logs and snapshots, empty to keep state in memory only")
+	mode := flag.String("mode", ClassicMode, "Consensus protocol of the cluster: classic, fast (Fast Paxos) or epaxos (Egalitarian Paxos, without crash recovery)")
+	phase1Quorum := flag.Int("phase1-quorum", 0, "Acceptors that must promise a ballot, 0 for a majority")
+	phase2Quorum := flag.Int("phase2-quorum", 0, "Acceptors that must accept a value in a classic round, 0 for a majority")
+	reconfigDelay := flag.Int64("reconfig-delay", 1, "Slots between a reconfiguration entry in the log and the slot it takes effect at")
+	batchWindow := flag.Duration("batch-window", 0, "Time the leader waits for more commands before proposing a batch that is not full")
+	batchSize := flag.Int("batch-size", 1, "Most commands the leader proposes together in one slot, 1 disables batching")
+	pipelineWindow := flag.Int("pipeline", 1, "Most slots the leader keeps in the Accept phase at once, 1 disables pipelining")
+	leaseDuration := flag.Duration("lease", 0, "How long acceptors refuse other proposers after granting the leader a lease, 0 disables leases")
+	leaseDrift := flag.Duration("lease-drift", 100*time.Millisecond, "Bound on how far the clocks of two nodes drift apart over one lease duration")
+	snapshotSlots := flag.Int64("snapshot-interval", 1000, "Slots a learner applies between two snapshots, after which the log below is compacted, 0 disables snapshots")
+	catchUp := flag.Duration("catchup-interval", time.Second, "How often a learner checks whether it missed slots and asks the acceptors for them")
+	connectTimeout := flag.Duration("connect-timeout", 10*time.Second, "How long to wait at startup for peers to accept connections")
+	stateMachine := flag.String("state-machine", "register", "Name of the registered state machine each instance applies chosen commands to")
 
 	// Parse command-line flags
 	flag.Parse()
 
-	return *hostfile, *proposerValue, *timeDelay
+	if *mode != ClassicMode && *mode != FastMode && *mode != EPaxosMode {
+		log.Fatalf("unknown mode %q, expected %s, %s or %s", *mode, ClassicMode, FastMode, EPaxosMode)
+	}
+	// Timers and tickers cannot run with a period of zero or less
+	requirePositive("phase-timeout", *phaseTimeout)
+	requirePositive("heartbeat", *heartbeat)
+	requirePositive("election-timeout", *election)
+	requirePositive("catchup-interval", *catchUp)
+	if *snapshotSlots < 0 {
+		usageError("invalid value %v for flag -snapshot-interval: must not be negative", *snapshotSlots)
+	}
+
+	return Config{
+		Hostfile:       *hostfile,
+		ProposerValue:  *proposerValue,
+		TimeDelay:      *timeDelay,
+		ReadDelay:      *readDelay,
+		PhaseTimeout:   *phaseTimeout,
+		BackoffBase:    *backoffBase,
+		BackoffMax:     *backoffMax,
+		MaxAttempts:    *maxAttempts,
+		Heartbeat:      *heartbeat,
+		Election:       *election,
+		DataDir:        *dataDir,
+		ConnectTimeout: *connectTimeout,
+		Mode:           *mode,
+		Phase1Quorum:   *phase1Quorum,
+		Phase2Quorum:   *phase2Quorum,
+		ReconfigDelay:  *reconfigDelay,
+		BatchWindow:    *batchWindow,
+		BatchSize:      *batchSize,
+		PipelineWindow: *pipelineWindow,
+		LeaseDuration:  *leaseDuration,
+		LeaseDrift:     *leaseDrift,
+		SnapshotSlots:  *snapshotSlots,
+		CatchUp:        *catchUp,
+		StateMachine:   *stateMachine,
+	}
+}
+
+// requirePositive rejects a duration flag that is zero or negative.
+func requirePositive(name string, value time.Duration) {
+	if value <= 0 {
+		usageError("invalid value %v for flag -%s: must be positive", value, name)
+	}
+}
+
+// usageError rejects a flag value the way the flag package rejects a value it cannot parse: with the message, the
+// usage message and exit status 2.
+func usageError(format string, args ...interface{}) {
+	fmt.Fprintf(flag.CommandLine.Output(), format+"\n", args...)
+	flag.Usage()
+	os.Exit(2)
 }
 
 // ReadHostfile reads the hostfile and returns a map where keys are line numbers (ID) and values are HostInfo.
 // Additionally, it returns a quorum map indicating which acceptors are associated with each proposer.
+// Numbered roles form independent Paxos instances: proposerN uses the hosts that run acceptorN, which includes
+// its own host when that host also runs acceptorN. The quorum map lists only these main acceptors, and the
+// auxiliary acceptors of an instance are found with AuxiliaryHosts. Several hosts may run the proposer of the same
+// instance; they elect a leader among themselves, and ballots break ties by host ID, not by proposer number.
 func ReadHostfile(fileName string) (map[int64]HostInfo, map[int64][]int64) {
 	hostRoles := make(map[int64]HostInfo)
 	quorumMap := make(map[int64][]int64)
@@ -59,13 +178,18 @@ func ReadHostfile(fileName string) (map[int64]HostInfo, map[int64][]int64) {
 		roles := strings.Split(rolesStr, ",")
 
 		hostInfo := HostInfo{
-			Hostname: hostname,
-			Proposer: []int64{},
-			Acceptor: []int64{},
-			Learner:  []int64{},
+			Hostname:  hostname,
+			Proposer:  []int64{},
+			Acceptor:  []int64{},
+			Learner:   []int64{},
+			Auxiliary: []int64{},
 		}
 
 		for _, role := range roles {
+			// A host without roles is a spare that may join an acceptor set through reconfiguration
+			if role == "" {
+				continue
+			}
 			roleParts := strings.Split(role, ProposerRole)
 			if len(roleParts) == 2 {
 				num, err := strconv.ParseInt(roleParts[1], 10, 64)
@@ -87,11 +211,29 @@ func ReadHostfile(fileName string) (map[int64]HostInfo, map[int64][]int64) {
 					log.Fatalf("invalid role number in hostfile for %s: %v", role, err)
 				}
 				if num != 0 {
+					if slices.Contains(hostInfo.Auxiliary, num) {
+						log.Fatalf("invalid hostfile: %s runs both %s and %s%d", hostname, role, AuxiliaryRole, num)
+					}
 					hostInfo.Acceptor = append(hostInfo.Acceptor, num)
 				}
 				continue
 			}
 
+			roleParts = strings.Split(role, AuxiliaryRole)
+			if len(roleParts) == 2 {
+				num, err := strconv.ParseInt(roleParts[1], 10, 64)
+				if err != nil {
+					log.Fatalf("invalid role number in hostfile for %s: %v", role, err)
+				}
+				if num != 0 {
+					if slices.Contains(hostInfo.Acceptor, num) {
+						log.Fatalf("invalid hostfile: %s runs both %s%d and %s", hostname, AcceptorRole, num, role)
+					}
+					hostInfo.Auxiliary = append(hostInfo.Auxiliary, num)
+				}
+				continue
+			}
+
 			roleParts = strings.Split(role, LearnerRole)
 			if len(roleParts) == 2 {
 				num, err := strconv.ParseInt(roleParts[1], 10, 64)
@@ -111,14 +253,11 @@ func ReadHostfile(fileName string) (map[int64]HostInfo, map[int64][]int64) {
 		lineID++
 	}
 
-	// Populate quorumMap with acceptors for each proposer
-	for id, hostInfo := range hostRoles {
-		for _, proposerID := range hostInfo.Proposer {
-			for acceptorID, acceptorInfo := range hostRoles {
-				if id != acceptorID && len(acceptorInfo.Acceptor) > 0 {
-					quorumMap[proposerID] = append(quorumMap[proposerID], acceptorID)
-				}
-			}
+	// Populate quorumMap with the acceptors of each proposer's instance
+	for proposerID := range quorumMap {
+		quorumMap[proposerID] = AcceptorHosts(hostRoles, proposerID)
+		if len(quorumMap[proposerID]) == 0 {
+			log.Fatalf("invalid hostfile: %s%d has no %s%d", ProposerRole, proposerID, AcceptorRole, proposerID)
 		}
 	}
 
@@ -128,3 +267,47 @@ func ReadHostfile(fileName string) (map[int64]HostInfo, map[int64][]int64) {
 
 	return hostRoles, quorumMap
 }
+
+// AcceptorHosts returns the IDs of all hosts that run an acceptor of the given instance, in ascending order.
+func AcceptorHosts(hostRoles map[int64]HostInfo, instance int64) []int64 {
+	return hostsWithRole(hostRoles, instance, func(info HostInfo) []int64 { return info.Acceptor })
+}
+
+// AuxiliaryHosts returns the IDs of all hosts that run an auxiliary acceptor of the given instance, in ascending order.
+func AuxiliaryHosts(hostRoles map[int64]HostInfo, instance int64) []int64 {
+	return hostsWithRole(hostRoles, instance, func(info HostInfo) []int64 { return info.Auxiliary })
+}
+
+// ProposerHosts returns the IDs of all hosts that run a proposer of the given instance, in ascending order.
+func ProposerHosts(hostRoles map[int64]HostInfo, instance int64) []int64 {
+	return hostsWithRole(hostRoles, instance, func(info HostInfo) []int64 { return info.Proposer })
+}
+
+// LearnerHosts returns the IDs of all hosts that run a learner of the given instance, in ascending order.
+func LearnerHosts(hostRoles map[int64]HostInfo, instance int64) []int64 {
+	return hostsWithRole(hostRoles, instance, func(info HostInfo) []int64 { return info.Learner })
+}
+
+// ReplicaHosts returns the IDs of all hosts that run any role of the given instance, in ascending order. In
+// EPaxos mode every one of them is a replica of the instance.
+func ReplicaHosts(hostRoles map[int64]HostInfo, instance int64) []int64 {
+	return hostsWithRole(hostRoles, instance, Instances)
+}
+
+// Instances returns the numbers of the instances a host runs any role of, in ascending order.
+func Instances(info HostInfo) []int64 {
+	instances := slices.Concat(info.Proposer, info.Acceptor, info.Learner, info.Auxiliary)
+	slices.Sort(instances)
+	return slices.Compact(instances)
+}
+
+func hostsWithRole(hostRoles map[int64]HostInfo, instance int64, roles func(HostInfo) []int64) []int64 {
+	hosts := []int64{}
+	for id, info := range hostRoles {
+		if slices.Contains(roles(info), instance) {
+			hosts = append(hosts, id)
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i] < hosts[j] })
+	return hosts
+}